@@ -22,6 +22,7 @@ func NewDBClient(ctx context.Context, dsn string) (DbClient, error) {
 type DbApi interface {
 	pg_api.SQLExecutor
 	pg_api.Transactor
+	pg_api.Acquirer
 	Pinger
 	Closer
 }
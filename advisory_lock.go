@@ -0,0 +1,100 @@
+package pg
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg/internal/logger"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"hash/fnv"
+	"log/slog"
+)
+
+// AdvisoryKey derives an advisory lock key from a name such as "account:42"
+func AdvisoryKey(name string) int64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(name))
+	return int64(hash.Sum64())
+}
+
+// AdvisoryLock is a session advisory lock pinned to its own pool connection
+type AdvisoryLock struct {
+	key  int64
+	conn *pgxpool.Conn
+}
+
+// WithAdvisoryLock waits for the session advisory lock key and holds it while fn runs.
+// The lock lives on a dedicated connection, fn's own queries use the pool as usual.
+func (db DbClient) WithAdvisoryLock(ctx context.Context, key int64, fn func(ctx context.Context) error) error {
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return errors.Wrap(err, "can't acquire connection for advisory lock")
+	}
+	if _, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+		conn.Release()
+		return errors.Wrap(err, "can't take advisory lock")
+	}
+	lock := &AdvisoryLock{key: key, conn: conn}
+	defer func() {
+		if err := lock.Release(context.WithoutCancel(ctx)); err != nil {
+			logger.Logger().Error("advisory unlock failed", slog.Int64("key", key), slog.Any("err", err))
+		}
+	}()
+	return fn(ctx)
+}
+
+// TryAdvisoryLock takes the session advisory lock key without waiting, ok is false when it is held elsewhere.
+// The lock is kept until Release.
+func (db DbClient) TryAdvisoryLock(ctx context.Context, key int64) (lock *AdvisoryLock, ok bool, err error) {
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "can't acquire connection for advisory lock")
+	}
+	if err = conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&ok); err != nil || !ok {
+		conn.Release()
+		return nil, false, errors.Wrap(err, "can't take advisory lock")
+	}
+	return &AdvisoryLock{key: key, conn: conn}, true, nil
+}
+
+// Release unlocks and returns the connection to the pool. When unlocking fails the connection is closed,
+// which drops the lock together with the session.
+func (l *AdvisoryLock) Release(ctx context.Context) error {
+	if l.conn == nil {
+		return nil
+	}
+	conn := l.conn
+	l.conn = nil
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		_ = conn.Conn().Close(ctx)
+		return errors.Wrap(err, "can't release advisory lock")
+	}
+	return nil
+}
+
+// Conn is the connection holding the lock
+func (l *AdvisoryLock) Conn() *pgxpool.Conn {
+	return l.conn
+}
+
+// XactAdvisoryLock waits for the advisory lock key in the transaction from TxKey, it is released at commit or rollback
+func (db DbClient) XactAdvisoryLock(ctx context.Context, key int64) error {
+	if _, ok := ctx.Value(pg_api.TxKey).(pgx.Tx); !ok {
+		return ErrNoTransaction
+	}
+	_, err := db.ExecContext(ctx, pg_api.Query{Name: "XactAdvisoryLock", QueryRaw: "SELECT pg_advisory_xact_lock($1)"}, key)
+	return err
+}
+
+// TryXactAdvisoryLock takes the advisory lock key in the transaction from TxKey without waiting
+func (db DbClient) TryXactAdvisoryLock(ctx context.Context, key int64) (bool, error) {
+	if _, ok := ctx.Value(pg_api.TxKey).(pgx.Tx); !ok {
+		return false, ErrNoTransaction
+	}
+	var ok bool
+	err := db.QueryRowContext(ctx, pg_api.Query{Name: "TryXactAdvisoryLock", QueryRaw: "SELECT pg_try_advisory_xact_lock($1)"}, key).
+		Scan(&ok)
+	return ok, err
+}
@@ -0,0 +1,90 @@
+package pg
+
+import (
+	"context"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/lann/builder"
+	"github.com/pkg/errors"
+)
+
+// selectExpr swaps the repository columns for columns keeping its table, joins and filters
+func (repo Repository[T]) selectExpr(columns ...string) sq.SelectBuilder {
+	selectBuilder := builder.Delete(repo.SelectBuilder, "Columns").(sq.SelectBuilder)
+	selectBuilder = builder.Delete(selectBuilder, "OrderByParts").(sq.SelectBuilder)
+	return selectBuilder.Columns(columns...)
+}
+
+func (repo Repository[T]) Count(ctx context.Context, where sq.Sqlizer) int64 {
+	return Aggregate[T, int64](ctx, repo, "count(*)", where)
+}
+
+func (repo Repository[T]) Exists(ctx context.Context, where sq.Sqlizer) bool {
+	selectBuilder := repo.selectExpr("1").Limit(1)
+	if where != nil {
+		selectBuilder = selectBuilder.Where(where)
+	}
+	var one int
+	err := repo.DB.QueryRowContextSelect(ctx, selectBuilder).Scan(&one)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		panic(err)
+	}
+	return true
+}
+
+// Aggregate evaluates a single aggregate expression such as "max(created_at)" over the repository table.
+// NULL, returned by most aggregates on an empty set, is reported as the zero value.
+func Aggregate[T any, V any](ctx context.Context, repo Repository[T], expr string, where sq.Sqlizer) V {
+	selectBuilder := repo.selectExpr(expr)
+	if where != nil {
+		selectBuilder = selectBuilder.Where(where)
+	}
+	var value *V
+	if err := repo.DB.QueryRowContextSelect(ctx, selectBuilder).Scan(&value); err != nil {
+		panic(err)
+	}
+	if value == nil {
+		var zero V
+		return zero
+	}
+	return *value
+}
+
+func Sum[T any, V any](ctx context.Context, repo Repository[T], column string, where sq.Sqlizer) V {
+	return Aggregate[T, V](ctx, repo, "sum("+column+")", where)
+}
+
+func Min[T any, V any](ctx context.Context, repo Repository[T], column string, where sq.Sqlizer) V {
+	return Aggregate[T, V](ctx, repo, "min("+column+")", where)
+}
+
+func Max[T any, V any](ctx context.Context, repo Repository[T], column string, where sq.Sqlizer) V {
+	return Aggregate[T, V](ctx, repo, "max("+column+")", where)
+}
+
+// CountBy counts rows per distinct value of column. Rows where column is NULL are left out.
+func CountBy[T any, K comparable](ctx context.Context, repo Repository[T], column string, where sq.Sqlizer) map[K]int64 {
+	selectBuilder := repo.selectExpr(column, "count(*)").Where(sq.NotEq{column: nil}).GroupBy(column)
+	if where != nil {
+		selectBuilder = selectBuilder.Where(where)
+	}
+	rows := repo.DB.QueryContextSelect(ctx, selectBuilder, nil)
+	defer rows.Close()
+
+	counts := make(map[K]int64)
+	for rows.Next() {
+		var key K
+		var count int64
+		if err := rows.Scan(&key, &count); err != nil {
+			panic(err)
+		}
+		counts[key] = count
+	}
+	if err := rows.Err(); err != nil {
+		panic(err)
+	}
+	return counts
+}
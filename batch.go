@@ -0,0 +1,106 @@
+package pg
+
+import (
+	"context"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lann/builder"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg/pkg/transaction"
+)
+
+// BatchOptions tunes ForEachBatchWithOptions
+type BatchOptions struct {
+	// ResumeAfter is the LastID checkpoint of an interrupted run, batches start right after it
+	ResumeAfter int64
+	// Transaction when set runs reading and processing of every batch in its own transaction
+	Transaction *transaction.TxOptions
+	// OnProgress is called after every successfully processed batch
+	OnProgress func(BatchProgress)
+}
+
+type BatchProgress struct {
+	Batches   int64
+	Processed int64
+	LastID    int64 // checkpoint to pass as BatchOptions.ResumeAfter
+}
+
+// ForEachBatch walks all entities matching where in primary key order, batchSize entities at a time.
+// Entities must implement Identifiable. Processing stops at the first error returned by fn.
+func (repo Repository[T]) ForEachBatch(ctx context.Context, where sq.Sqlizer, batchSize uint64,
+	fn func(ctx context.Context, batch []T) error) error {
+	return repo.ForEachBatchWithOptions(ctx, where, batchSize, BatchOptions{}, fn)
+}
+
+func (repo Repository[T]) ForEachBatchWithOptions(ctx context.Context, where sq.Sqlizer, batchSize uint64,
+	opts BatchOptions, fn func(ctx context.Context, batch []T) error) error {
+	if batchSize == 0 {
+		return errors.New("batch size must be positive")
+	}
+	selectBuilder := builder.Delete(repo.SelectBuilder, "OrderByParts").(sq.SelectBuilder).
+		OrderBy(idColumn).Limit(batchSize)
+	if where != nil {
+		selectBuilder = selectBuilder.Where(where)
+	}
+
+	progress := BatchProgress{LastID: opts.ResumeAfter}
+	for {
+		// size and lastID are reset on every run, a retried transaction reads the same batch again
+		var size int
+		var lastID int64
+		processBatch := func(ctx context.Context) error {
+			size, lastID = 0, 0
+			batch, last, err := repo.nextBatch(ctx, selectBuilder.Where(sq.Gt{idColumn: progress.LastID}))
+			if err != nil || len(batch) == 0 {
+				return err
+			}
+			if err = fn(ctx, batch); err != nil {
+				return err
+			}
+			size, lastID = len(batch), last
+			return nil
+		}
+
+		var err error
+		if opts.Transaction != nil {
+			err = repo.DB.RunTransaction(ctx, *opts.Transaction, processBatch)
+		} else {
+			err = processBatch(ctx)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "batch after id %d failed", progress.LastID)
+		}
+		if size == 0 {
+			return nil
+		}
+
+		// the checkpoint moves only once the batch is committed
+		progress.LastID = lastID
+		progress.Batches++
+		progress.Processed += int64(size)
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+		if uint64(size) < batchSize {
+			return nil
+		}
+	}
+}
+
+func (repo Repository[T]) nextBatch(ctx context.Context, selectBuilder sq.SelectBuilder) ([]T, int64, error) {
+	var batch []T
+	for obj, err := range repo.IterateBuilder(ctx, selectBuilder) {
+		if err != nil {
+			return nil, 0, err
+		}
+		batch = append(batch, obj)
+	}
+	if len(batch) == 0 {
+		return nil, 0, nil
+	}
+	ident, ok := any(batch[len(batch)-1]).(Identifiable)
+	if !ok {
+		var zero T
+		return nil, 0, errors.Errorf("%T must implement Identifiable to be processed in batches", zero)
+	}
+	return repo.loadRelationsForCollection(ctx, batch), ident.GetID(), nil
+}
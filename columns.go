@@ -0,0 +1,101 @@
+package pg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/lann/builder"
+	"strings"
+)
+
+// readOnlyColumns are never accepted as update keys
+var readOnlyColumns = []string{idColumn, "created_at"}
+
+// ColumnNotUpdatableError is the panic value of Update and UpdateCollection called with a key
+// which is not an updatable column of the repository
+type ColumnNotUpdatableError struct {
+	Column   string
+	ReadOnly bool
+}
+
+func (e *ColumnNotUpdatableError) Error() string {
+	if e.ReadOnly {
+		return fmt.Sprintf("column %q is read only", e.Column)
+	}
+	return fmt.Sprintf("unknown column %q", e.Column)
+}
+
+// updatableColumns is empty when the repository declares neither UpdatableColumns nor insert columns,
+// then every key is refused
+func (repo Repository[T]) updatableColumns() []string {
+	if len(repo.UpdatableColumns) > 0 {
+		return repo.UpdatableColumns
+	}
+	columns, _ := builder.Get(repo.InsertBuilder, "Columns")
+	insertColumns, _ := columns.([]string)
+	return insertColumns
+}
+
+func (repo Repository[T]) checkUpdatable(fields map[string]interface{}) error {
+	updatable := repo.updatableColumns()
+	for column := range fields {
+		if containsColumn(readOnlyColumns, column) {
+			return &ColumnNotUpdatableError{Column: column, ReadOnly: true}
+		}
+		if !containsColumn(updatable, column) {
+			return &ColumnNotUpdatableError{Column: column}
+		}
+	}
+	return nil
+}
+
+// containsColumn compares case insensitively as PostgreSQL folds unquoted identifiers
+func containsColumn(columns []string, column string) bool {
+	for _, c := range columns {
+		if strings.EqualFold(strings.TrimSpace(c), strings.TrimSpace(column)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Optional is a patch field, it is written only when Set
+type Optional[V any] struct {
+	Value V
+	Set   bool
+}
+
+func Some[V any](value V) Optional[V] {
+	return Optional[V]{Value: value, Set: true}
+}
+
+// UnmarshalJSON marks the field as Set when it is present in the document, explicit null included
+func (o *Optional[V]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+// Changes are the columns to update collected from a patch
+type Changes map[string]interface{}
+
+// SetIf adds column to changes when field is set
+func SetIf[V any](changes Changes, column string, field Optional[V]) Changes {
+	if field.Set {
+		changes[column] = field.Value
+	}
+	return changes
+}
+
+// Patch is a typed alternative to the Update field map, usually a struct of Optional fields
+type Patch interface {
+	Changes() Changes
+}
+
+// ApplyPatch updates the entity by id with the set fields of patch, nothing is executed when no field is set
+func (repo Repository[T]) ApplyPatch(ctx context.Context, patch Patch, id int64) int64 {
+	changes := patch.Changes()
+	if len(changes) == 0 {
+		return 0
+	}
+	return repo.Update(ctx, changes, id)
+}
@@ -0,0 +1,104 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"iter"
+	"sync/atomic"
+)
+
+const DefaultFetchSize = 1000
+
+var cursorSeq atomic.Uint64
+
+// Cursor streams the result of selectBuilder through a server side cursor, fetching fetchSize rows per round trip,
+// so the result set never has to fit into client memory at once.
+// The cursor lives in the transaction from TxKey, when there is none a read only transaction is opened
+// and finished together with the iteration. Relations are not loaded for streamed entities.
+func (repo Repository[T]) Cursor(ctx context.Context, selectBuilder sq.SelectBuilder, fetchSize int) iter.Seq2[T, error] {
+	if fetchSize <= 0 {
+		fetchSize = DefaultFetchSize
+	}
+	return func(yield func(T, error) bool) {
+		var zero T
+		query, args, err := selectBuilder.PlaceholderFormat(sq.Dollar).ToSql()
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+
+		// cleanup has to run even when ctx is canceled
+		cleanupCtx := context.WithoutCancel(ctx)
+		tx, inTx := ctx.Value(pg_api.TxKey).(pgx.Tx)
+		if !inTx {
+			tx, err = repo.DB.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+			if err != nil {
+				yield(zero, errors.Wrap(err, "can't begin cursor transaction"))
+				return
+			}
+			defer func() {
+				_ = tx.Rollback(cleanupCtx) // no-op after a successful commit
+			}()
+		}
+
+		name := fmt.Sprintf("repository_cursor_%d", cursorSeq.Add(1))
+		if _, err = tx.Exec(ctx, "DECLARE "+name+" NO SCROLL CURSOR FOR "+query, args...); err != nil {
+			yield(zero, errors.Wrap(err, "can't declare cursor"))
+			return
+		}
+		if inTx {
+			defer func() {
+				_, _ = tx.Exec(cleanupCtx, "CLOSE "+name)
+			}()
+		}
+
+		fetch := fmt.Sprintf("FETCH FORWARD %d FROM %s", fetchSize, name)
+		for {
+			batch, fetched, err := repo.fetchBatch(ctx, tx, fetch)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			for _, obj := range batch {
+				if !yield(obj, nil) {
+					return
+				}
+			}
+			if fetched < fetchSize {
+				break
+			}
+		}
+
+		if !inTx {
+			if err = tx.Commit(ctx); err != nil {
+				yield(zero, errors.Wrap(err, "can't commit cursor transaction"))
+			}
+		}
+	}
+}
+
+// fetchBatch reads one FETCH worth of rows and closes them before they are yielded,
+// so the loop body can use the connection of the transaction
+func (repo Repository[T]) fetchBatch(ctx context.Context, tx pgx.Tx, fetch string) (batch []T, fetched int, err error) {
+	rows, err := tx.Query(ctx, fetch)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "can't fetch from cursor")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		fetched++
+		obj, ok, err := repo.convertRow(rows)
+		if err != nil {
+			return nil, fetched, err
+		}
+		if ok {
+			batch = append(batch, obj)
+		}
+	}
+	return batch, fetched, rows.Err()
+}
@@ -0,0 +1,100 @@
+package pg
+
+import (
+	"context"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lann/builder"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"strings"
+)
+
+// deleteBuilder falls back to the repository table when the repository was created with an empty DeleteBuilder
+func (repo Repository[T]) deleteBuilder() sq.DeleteBuilder {
+	if from, ok := builder.Get(repo.DeleteBuilder, "From"); ok && from.(string) != "" {
+		return repo.DeleteBuilder
+	}
+	return sq.Delete(repo.table()).PlaceholderFormat(sq.Dollar)
+}
+
+func (repo Repository[T]) DeleteBy(ctx context.Context, where sq.Sqlizer) int64 {
+	return repo.DB.ExecDelete(ctx, repo.deleteBuilder().Where(where))
+}
+
+// DeleteReturning deletes entities matching where and returns them as they were before deletion.
+// The SelectBuilder columns are used for RETURNING, so it doesn't work for repositories selecting from joins.
+// Relations are not loaded since dependent rows might have been removed together with the entities.
+// Over the WithMaxAffectedRows limit the deletion is rolled back, to a savepoint inside a transaction.
+func (repo Repository[T]) DeleteReturning(ctx context.Context, where sq.Sqlizer) []T {
+	if err := pg_api.CheckWhere(ctx, []sq.Sqlizer{where}); err != nil {
+		panic(err)
+	}
+	deleteBuilder := repo.deleteBuilder().Where(where).Suffix("RETURNING " + strings.Join(repo.columns(), ", "))
+	query, args, err := deleteBuilder.PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		panic(err)
+	}
+	limit, limited := pg_api.MaxAffectedRows(ctx)
+	if !limited {
+		objs, _ := repo.deleteReturning(ctx, query, args)
+		return objs
+	}
+
+	var objs []T
+	err = repo.DB.RunTransaction(ctx, transaction.TxOptions{}, func(ctx context.Context) error {
+		var affected int64
+		objs, affected = repo.deleteReturning(ctx, query, args)
+		if affected > limit {
+			return &TooManyRowsAffectedError{Limit: limit, Affected: affected}
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return objs
+}
+
+func (repo Repository[T]) deleteReturning(ctx context.Context, query string, args []interface{}) ([]T, int64) {
+	rows, err := repo.DB.QueryContext(ctx, pg_api.Query{Name: "DeleteReturning", QueryRaw: query}, args...)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+	objs := repo.convertToObjects(rows)
+	rows.Close()
+	return objs, rows.CommandTag().RowsAffected()
+}
+
+// DeleteInBatches deletes entities matching where at most batchSize rows per statement and returns the total count.
+// Outside of a transaction every statement commits on its own, so huge purges never hold locks for long.
+func (repo Repository[T]) DeleteInBatches(ctx context.Context, where sq.Sqlizer, batchSize uint64) int64 {
+	if batchSize == 0 {
+		panic("batch size must be positive")
+	}
+	// the ctid condition below always bounds the statement, so check the caller's condition
+	if err := pg_api.CheckWhere(ctx, []sq.Sqlizer{where}); err != nil {
+		panic(err)
+	}
+	batch := sq.Select("ctid").From(repo.table()).Limit(batchSize)
+	if where != nil {
+		batch = batch.Where(where)
+	}
+	batchQuery, args, err := batch.ToSql()
+	if err != nil {
+		panic(err)
+	}
+	deleteBuilder := repo.deleteBuilder().Where(sq.Expr("ctid = ANY(ARRAY("+batchQuery+"))", args...))
+
+	var total int64
+	for {
+		deleted := repo.DB.ExecDelete(ctx, deleteBuilder)
+		total += deleted
+		if deleted < int64(batchSize) {
+			return total
+		}
+		if err = ctx.Err(); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg/internal/logger"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"log/slog"
+	"sync"
+)
+
+// EventSource is implemented by entities recording domain events, PullEvents returns the recorded
+// events and forgets them
+type EventSource interface {
+	PullEvents() []any
+}
+
+// EventRecorder is embedded by entities to implement EventSource
+type EventRecorder struct {
+	events []any
+}
+
+func (r *EventRecorder) Record(event any) {
+	r.events = append(r.events, event)
+}
+
+func (r *EventRecorder) PullEvents() []any {
+	events := r.events
+	r.events = nil
+	return events
+}
+
+// DispatchMode says when an event handler runs
+type DispatchMode int
+
+const (
+	// Sync handlers run inside the transaction of the save, their error rolls it back
+	Sync DispatchMode = iota
+	// AfterCommit handlers run once the outermost transaction commits, their errors are only logged
+	AfterCommit
+)
+
+// EventBus routes domain events to the handlers subscribed to their type
+type EventBus struct {
+	mu       sync.RWMutex
+	handlers []eventHandler
+}
+
+type eventHandler struct {
+	mode   DispatchMode
+	handle func(ctx context.Context, event any) (bool, error)
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe registers handler for events assignable to E, an interface E receives every event implementing it.
+// Handlers run in the order they were subscribed.
+func Subscribe[E any](bus *EventBus, mode DispatchMode, handler func(ctx context.Context, event E) error) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.handlers = append(bus.handlers, eventHandler{mode: mode, handle: func(ctx context.Context, event any) (bool, error) {
+		e, ok := event.(E)
+		if !ok {
+			return false, nil
+		}
+		return true, handler(ctx, e)
+	}})
+}
+
+// Dispatch runs the Sync handlers of events now, stopping at the first error,
+// and registers the AfterCommit ones with the transaction from the context
+func (bus *EventBus) Dispatch(ctx context.Context, events ...any) error {
+	bus.mu.RLock()
+	handlers := bus.handlers
+	bus.mu.RUnlock()
+
+	for _, event := range events {
+		for _, h := range handlers {
+			if h.mode == AfterCommit {
+				transaction.AfterCommit(ctx, func(ctx context.Context) {
+					if _, err := h.handle(ctx, event); err != nil {
+						logger.Logger().Error("event handler failed", slog.String("event", fmt.Sprintf("%T", event)), slog.Any("err", err))
+					}
+				})
+				continue
+			}
+			if _, err := h.handle(ctx, event); err != nil {
+				return errors.Wrapf(err, "handling %T", event)
+			}
+		}
+	}
+	return nil
+}
+
+// pullEvents takes the recorded events of entity, nil when it is no EventSource
+func pullEvents[T any](entity *T) []any {
+	if source, ok := any(entity).(EventSource); ok {
+		return source.PullEvents()
+	}
+	if source, ok := any(*entity).(EventSource); ok {
+		return source.PullEvents()
+	}
+	return nil
+}
+
+// recordEvents puts events back on entity, when it can record them
+func recordEvents[T any](entity *T, events []any) {
+	recorder, ok := any(entity).(interface{ Record(event any) })
+	if !ok {
+		return
+	}
+	for _, event := range events {
+		recorder.Record(event)
+	}
+}
+
+// saveWithEvents runs save and dispatches the events recorded on entity in one transaction,
+// joining the one from the context as a savepoint. The events are recorded again when the save
+// or the transaction it joined rolls back, so a retried save dispatches them.
+func (repo Repository[T]) saveWithEvents(ctx context.Context, entity *T, save func(ctx context.Context) int64) int64 {
+	events := pullEvents(entity)
+	restored := false
+	restore := func(context.Context) {
+		if !restored {
+			restored = true
+			recordEvents(entity, events)
+		}
+	}
+
+	var result int64
+	err := repo.DB.RunTransaction(ctx, transaction.TxOptions{}, func(ctx context.Context) error {
+		transaction.AfterRollback(ctx, restore)
+		result = save(ctx)
+		if repo.Events == nil {
+			return nil
+		}
+		return repo.Events.Dispatch(ctx, events...)
+	})
+	if err != nil {
+		// the transaction may fail before the rollback hook is registered
+		restore(ctx)
+		panic(err)
+	}
+	return result
+}
+
+// CreateEntity is Create followed by dispatching the events recorded on entity to Events, it returns the new id
+func (repo Repository[T]) CreateEntity(ctx context.Context, entity *T, values ...interface{}) int64 {
+	return repo.saveWithEvents(ctx, entity, func(ctx context.Context) int64 {
+		return repo.Create(ctx, values...)
+	})
+}
+
+// UpdateEntity is Update of the Identifiable entity followed by dispatching its events, it returns the affected rows
+func (repo Repository[T]) UpdateEntity(ctx context.Context, entity *T, fields map[string]interface{}) int64 {
+	id := entityID(entity)
+	return repo.saveWithEvents(ctx, entity, func(ctx context.Context) int64 {
+		return repo.Update(ctx, fields, id)
+	})
+}
+
+// DeleteEntity is Delete of the Identifiable entity followed by dispatching its events, it returns the affected rows
+func (repo Repository[T]) DeleteEntity(ctx context.Context, entity *T) int64 {
+	id := entityID(entity)
+	return repo.saveWithEvents(ctx, entity, func(ctx context.Context) int64 {
+		return repo.Delete(ctx, id)
+	})
+}
+
+func entityID[T any](entity *T) int64 {
+	if ident, ok := any(entity).(Identifiable); ok {
+		return ident.GetID()
+	}
+	if ident, ok := any(*entity).(Identifiable); ok {
+		return ident.GetID()
+	}
+	panic(errors.Errorf("%T must implement Identifiable", *entity))
+}
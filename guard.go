@@ -0,0 +1,22 @@
+package pg
+
+import (
+	"context"
+	"github.com/simpleGorm/pg/internal/pg_api"
+)
+
+// ErrUnboundedStatement is the panic value of UPDATE and DELETE calls without WHERE clause
+var ErrUnboundedStatement = pg_api.ErrUnboundedStatement
+
+type TooManyRowsAffectedError = pg_api.TooManyRowsAffectedError
+
+// AllowUnbounded lets calls made with the returned context update or delete whole tables
+func AllowUnbounded(ctx context.Context) context.Context {
+	return pg_api.AllowUnbounded(ctx)
+}
+
+// WithMaxAffectedRows makes UPDATE and DELETE calls made with the returned context panic with
+// *TooManyRowsAffectedError and roll back when they touch more than limit rows
+func WithMaxAffectedRows(ctx context.Context, limit int64) context.Context {
+	return pg_api.WithMaxAffectedRows(ctx, limit)
+}
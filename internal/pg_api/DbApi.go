@@ -4,10 +4,13 @@ import (
 	"context"
 	"github.com/Masterminds/squirrel"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/simpleGorm/pg/pkg/transaction"
 )
 
-type TransactionalFlow func(ctx context.Context) error
+// TransactionalFlow is an alias so that DbClient satisfies transaction.Runner
+type TransactionalFlow = func(ctx context.Context) error
 
 type TxManager interface {
 	Transaction(ctx context.Context, opts transaction.TxOptions, f TransactionalFlow) error
@@ -22,9 +25,15 @@ type Transactor interface {
 	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
 }
 
+// Acquirer hands out a dedicated pool connection, for session state such as advisory locks
+type Acquirer interface {
+	Acquire(ctx context.Context) (*pgxpool.Conn, error)
+}
+
 type SQLExecutor interface {
 	//NamedQueryExecutor
 	QueryExecutor
+	RawQueryExecutor
 	Pinger
 }
 
@@ -43,6 +52,13 @@ type QueryExecutor interface {
 	RunTransaction(ctx context.Context, txOptions transaction.TxOptions, f TransactionalFlow) error
 }
 
+// RawQueryExecutor runs plain SQL and reports errors instead of panicking, inside the transaction from TxKey if any
+type RawQueryExecutor interface {
+	ExecContext(ctx context.Context, q Query, args ...interface{}) (pgconn.CommandTag, error)
+	QueryContext(ctx context.Context, q Query, args ...interface{}) (pgx.Rows, error)
+	QueryRowContext(ctx context.Context, q Query, args ...interface{}) pgx.Row
+}
+
 type Pinger interface {
 	Ping(ctx context.Context) error
 }
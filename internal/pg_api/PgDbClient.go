@@ -4,6 +4,7 @@ import (
 	"context"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pkg/errors"
 	"github.com/simpleGorm/pg/pkg/transaction"
@@ -38,6 +39,18 @@ func (c PgDbClient) QueryRowContextInsert(ctx context.Context, builder sq.Insert
 	return c.masterDBC.QueryRowContextInsert(ctx, builder)
 }
 
+func (c PgDbClient) ExecContext(ctx context.Context, q Query, args ...interface{}) (pgconn.CommandTag, error) {
+	return c.masterDBC.ExecContext(ctx, q, args...)
+}
+
+func (c PgDbClient) QueryContext(ctx context.Context, q Query, args ...interface{}) (pgx.Rows, error) {
+	return c.masterDBC.QueryContext(ctx, q, args...)
+}
+
+func (c PgDbClient) QueryRowContext(ctx context.Context, q Query, args ...interface{}) pgx.Row {
+	return c.masterDBC.QueryRowContext(ctx, q, args...)
+}
+
 func (c PgDbClient) Ping(ctx context.Context) error {
 	return c.masterDBC.Ping(ctx)
 }
@@ -46,6 +59,10 @@ func (c PgDbClient) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.T
 	return c.masterDBC.BeginTx(ctx, txOptions)
 }
 
+func (c PgDbClient) Acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	return c.masterDBC.Acquire(ctx)
+}
+
 func (c PgDbClient) Close() error {
 	if c.masterDBC.API != nil {
 		return c.masterDBC.Close()
@@ -2,13 +2,22 @@ package pg_api
 
 import (
 	"context"
+	"fmt"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg/internal/logger"
 	"github.com/simpleGorm/pg/pkg/transaction"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type PgTransactionManager struct {
-	db Transactor
+	db         Transactor
+	savepoints atomic.Uint64
 }
 
 func NewPgTransactionManager(db Transactor) *PgTransactionManager {
@@ -17,41 +26,172 @@ func NewPgTransactionManager(db Transactor) *PgTransactionManager {
 	}
 }
 
-func (m *PgTransactionManager) Transaction(ctx context.Context, opts transaction.TxOptions, fn TransactionalFlow) (err error) {
-	tx, ok := ctx.Value(TxKey).(pgx.Tx)
-	if ok {
+func (m *PgTransactionManager) Transaction(ctx context.Context, opts transaction.TxOptions, fn TransactionalFlow) error {
+	_, inTx := ctx.Value(TxKey).(pgx.Tx)
+	switch opts.Propagation {
+	case transaction.Required:
+		if inTx {
+			return m.join(ctx, opts, fn)
+		}
+	case transaction.RequiresNew:
+	case transaction.Mandatory:
+		if !inTx {
+			return transaction.ErrNoTransaction
+		}
+		return m.join(ctx, opts, fn)
+	case transaction.Never:
+		if inTx {
+			return transaction.ErrTransactionExists
+		}
+		return fn(ctx)
+	case transaction.Supports:
+		if inTx {
+			return m.join(ctx, opts, fn)
+		}
 		return fn(ctx)
+	case transaction.Nested, "":
+		if inTx {
+			if err := checkCompatible(ctx, opts); err != nil {
+				return err
+			}
+			// a failure rolls back only the work done inside the nested call
+			return transaction.Savepoint(ctx, fmt.Sprintf("nested_%d", m.savepoints.Add(1)), func(ctx context.Context) error {
+				return withLocalOptions(ctx, opts, fn)
+			})
+		}
+	default:
+		return errors.Errorf("unknown transaction propagation %q", opts.Propagation)
+	}
+	return m.retry(ctx, opts, fn)
+}
+
+// retry runs fn in new transactions until it succeeds or opts.Retry gives up
+func (m *PgTransactionManager) retry(ctx context.Context, opts transaction.TxOptions, fn TransactionalFlow) error {
+	for attempt := 1; ; attempt++ {
+		err := m.begin(ctx, opts, fn)
+		if err == nil || opts.Retry == nil || attempt >= opts.Retry.MaxAttempts || !opts.Retry.Retryable(err) {
+			return err
+		}
+
+		backoff := opts.Retry.Backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return err
+		}
+		logger.Logger().Warn("retrying transaction", slog.Int("attempt", attempt), slog.Any("err", err))
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// join runs fn in the transaction from the context
+func (m *PgTransactionManager) join(ctx context.Context, opts transaction.TxOptions, fn TransactionalFlow) error {
+	if err := checkCompatible(ctx, opts); err != nil {
+		return err
+	}
+	return withLocalOptions(ctx, opts, fn)
+}
+
+// withLocalOptions runs fn with the settings and deferred constraints of opts in the transaction from the context
+// and restores the outer ones after it. The deferred constraints are checked only when fn succeeds, a failed
+// transaction or savepoint is rolled back together with the settings.
+func withLocalOptions(ctx context.Context, opts transaction.TxOptions, fn TransactionalFlow) error {
+	outer, err := currentSettings(ctx, opts)
+	if err != nil {
+		return err
+	}
+	deferred, _ := ctx.Value(deferredKey).([]string)
+	immediate, err := immediateConstraints(deferred, opts.DeferConstraints)
+	if err != nil {
+		return err
+	}
+	if err = ApplyLocalOptions(ctx, opts); err != nil {
+		return err
+	}
+
+	if err = fn(context.WithValue(ctx, deferredKey, append(slices.Clip(deferred), opts.DeferConstraints...))); err != nil {
+		tx, _ := ctx.Value(TxKey).(pgx.Tx)
+		if tx.Conn().PgConn().TxStatus() != 'E' {
+			if errRestore := ApplyLocalOptions(ctx, transaction.TxOptions{Settings: outer}); errRestore != nil {
+				err = errors.Wrapf(err, "restoring settings failed: %v", errRestore)
+			}
+		}
+		return err
+	}
+	if err = ApplyLocalOptions(ctx, transaction.TxOptions{Settings: outer}); err != nil {
+		return err
+	}
+	return checkConstraints(ctx, immediate)
+}
+
+// checkCompatible refuses to run an inner call in an outer transaction with a different isolation level
+// or a read only outer transaction for a read write call
+func checkCompatible(ctx context.Context, inner transaction.TxOptions) error {
+	outer, _ := ctx.Value(txOptionsKey).(transaction.TxOptions)
+	if inner.IsoLevel != "" && isoLevel(inner) != isoLevel(outer) {
+		return errors.Wrapf(transaction.ErrIncompatibleTransaction,
+			"isolation level %q requested inside %q transaction", inner.IsoLevel, isoLevel(outer))
+	}
+	if inner.AccessMode == transaction.ReadWrite && outer.AccessMode == transaction.ReadOnly {
+		return errors.Wrap(transaction.ErrIncompatibleTransaction, "read write access requested inside read only transaction")
 	}
+	return nil
+}
+
+// isoLevel treats an unset level as read committed, the PostgreSQL default
+func isoLevel(opts transaction.TxOptions) transaction.TxIsoLevel {
+	if opts.IsoLevel == "" {
+		return transaction.ReadCommitted
+	}
+	return opts.IsoLevel
+}
+
+// begin runs fn in a new transaction on its own connection
+func (m *PgTransactionManager) begin(ctx context.Context, opts transaction.TxOptions, fn TransactionalFlow) (err error) {
 	pgOpts := toPgOptions(opts)
 
-	tx, err = m.db.BeginTx(ctx, pgOpts)
+	tx, err := m.db.BeginTx(ctx, pgOpts)
 	if err != nil {
 		return errors.Wrap(err, "can't begin transaction")
 	}
 
+	// hooks run without the finished transaction in their context
+	hooksCtx := ctx
+	ctx, hooks := transaction.WithHooks(ctx)
 	ctx = MakeContextTx(ctx, tx)
+	ctx = context.WithValue(ctx, txOptionsKey, opts)
+	ctx = context.WithValue(ctx, deferredKey, opts.DeferConstraints)
 
 	defer func() {
 		if r := recover(); r != nil {
-			err = errors.Errorf("[PgTransactionManager] panic recovered: %w", r)
+			// keeps the panic error in the chain, retries look for the SQLSTATE in it
+			err = transaction.NewPanicError(r)
 		}
 
 		if err != nil {
-			if errRollback := tx.Rollback(ctx); errRollback != nil {
-				//errRollback := errors.Wrapf(err, "errRollback: %v", errRollback)
-				panic(errRollback)
+			if errRollback := tx.Rollback(context.WithoutCancel(ctx)); errRollback != nil {
+				err = errors.Wrapf(err, "rollback failed: %v", errRollback)
 			}
+			hooks.RunAfterRollback(hooksCtx)
+			return
 		}
 
-		if nil == err {
-			err = tx.Commit(ctx)
-			if err != nil {
-				err = errors.Wrap(err, "tx commit failed")
-				panic(err)
-			}
+		// serialization failures are often reported at commit, so they are returned rather than panicked
+		if err = tx.Commit(ctx); err != nil {
+			err = errors.Wrap(constraintViolation(err), "tx commit failed")
+			hooks.RunAfterRollback(hooksCtx)
+			return
 		}
+		hooks.RunAfterCommit(hooksCtx)
 	}()
 
+	if err = ApplyLocalOptions(ctx, opts); err != nil {
+		return err
+	}
 	if err = fn(ctx); err != nil {
 		err = errors.Wrap(err, "failed executing code inside transaction")
 	}
@@ -62,6 +202,85 @@ func (m *PgTransactionManager) Transaction(ctx context.Context, opts transaction
 	return err
 }
 
+// ApplyLocalOptions issues SET LOCAL for the settings of opts and defers its constraints
+// in the transaction from the context
+func ApplyLocalOptions(ctx context.Context, opts transaction.TxOptions) error {
+	tx, _ := ctx.Value(TxKey).(pgx.Tx)
+	for _, setting := range opts.LocalSettings() {
+		// set_config with is_local is SET LOCAL accepting the value as a parameter
+		if _, err := tx.Exec(ctx, "SELECT set_config($1, $2, true)", setting.Name, setting.Value); err != nil {
+			return errors.Wrapf(err, "can't set %s", setting.Name)
+		}
+	}
+	if statement := opts.SetConstraintsStatement(); statement != "" {
+		if _, err := tx.Exec(ctx, statement); err != nil {
+			return errors.Wrap(err, "can't defer constraints")
+		}
+	}
+	return nil
+}
+
+// immediateConstraints lists the constraints an inner call defers and the outer transaction doesn't,
+// they are checked when the inner call completes. Deferring all of them can't be undone without
+// making the initially deferred constraints immediate as well, so it is refused.
+func immediateConstraints(outer, inner []string) ([]string, error) {
+	if slices.Contains(outer, transaction.AllConstraints) {
+		return nil, nil
+	}
+	if slices.Contains(inner, transaction.AllConstraints) {
+		return nil, errors.Wrap(transaction.ErrIncompatibleTransaction, "all constraints deferred inside a transaction")
+	}
+	var immediate []string
+	for _, name := range inner {
+		if !slices.Contains(outer, name) {
+			immediate = append(immediate, name)
+		}
+	}
+	return immediate, nil
+}
+
+// checkConstraints makes the constraints immediate again, which checks the changes made while they were deferred
+func checkConstraints(ctx context.Context, constraints []string) error {
+	statement := transaction.ImmediateConstraintsStatement(constraints)
+	if statement == "" {
+		return nil
+	}
+	tx, _ := ctx.Value(TxKey).(pgx.Tx)
+	if _, err := tx.Exec(ctx, statement); err != nil {
+		return errors.Wrap(constraintViolation(err), "deferred constraints violated")
+	}
+	return nil
+}
+
+// currentSettings reads the values of the settings of opts in the transaction from the context
+func currentSettings(ctx context.Context, opts transaction.TxOptions) (map[string]string, error) {
+	tx, _ := ctx.Value(TxKey).(pgx.Tx)
+	settings := map[string]string{}
+	for _, setting := range opts.LocalSettings() {
+		var value string
+		// missing_ok returns NULL for custom settings never set, an empty value resets them as well
+		if err := tx.QueryRow(ctx, "SELECT coalesce(current_setting($1, true), '')", setting.Name).Scan(&value); err != nil {
+			return nil, errors.Wrapf(err, "can't read %s", setting.Name)
+		}
+		settings[setting.Name] = value
+	}
+	return settings, nil
+}
+
+// constraintViolation reports integrity constraint violations, the ones raised by a commit are deferred ones
+func constraintViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, "23") {
+		return &transaction.ConstraintViolationError{
+			Constraint: pgErr.ConstraintName,
+			Table:      pgErr.TableName,
+			Code:       pgErr.Code,
+			Err:        pgErr,
+		}
+	}
+	return err
+}
+
 func toPgOptions(txOptions transaction.TxOptions) pgx.TxOptions {
 	return pgx.TxOptions{
 		IsoLevel:       pgx.TxIsoLevel(txOptions.IsoLevel),
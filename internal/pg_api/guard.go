@@ -0,0 +1,189 @@
+package pg_api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/lann/builder"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+type guardKey string
+
+const (
+	allowUnboundedKey  guardKey = "allow_unbounded"
+	maxAffectedRowsKey guardKey = "max_affected_rows"
+)
+
+var ErrUnboundedStatement = errors.New("UPDATE or DELETE without WHERE clause refused, use AllowUnbounded to run it")
+
+// TooManyRowsAffectedError is returned when a statement touches more rows than WithMaxAffectedRows allows,
+// the statement is rolled back together with its transaction
+type TooManyRowsAffectedError struct {
+	Limit    int64
+	Affected int64
+}
+
+func (e *TooManyRowsAffectedError) Error() string {
+	return fmt.Sprintf("statement affected %d rows, limit is %d", e.Affected, e.Limit)
+}
+
+// AllowUnbounded permits UPDATE and DELETE statements without WHERE clause for calls made with the returned context
+func AllowUnbounded(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowUnboundedKey, true)
+}
+
+// WithMaxAffectedRows limits the number of rows a single UPDATE or DELETE made with the returned context may touch
+func WithMaxAffectedRows(ctx context.Context, limit int64) context.Context {
+	return context.WithValue(ctx, maxAffectedRowsKey, limit)
+}
+
+// MaxAffectedRows returns the limit set with WithMaxAffectedRows
+func MaxAffectedRows(ctx context.Context) (int64, bool) {
+	limit, limited := ctx.Value(maxAffectedRowsKey).(int64)
+	return limit, limited
+}
+
+// CheckWhere refuses where parts which are empty or always true unless AllowUnbounded was used
+func CheckWhere(ctx context.Context, whereParts []sq.Sqlizer) error {
+	if allowed, _ := ctx.Value(allowUnboundedKey).(bool); allowed {
+		return nil
+	}
+	for _, part := range whereParts {
+		if part == nil {
+			continue
+		}
+		sql, _, err := part.ToSql()
+		if err != nil {
+			return err
+		}
+		if !isTautology(sql) {
+			return nil
+		}
+	}
+	return ErrUnboundedStatement
+}
+
+func checkBuilderWhere(ctx context.Context, b any) error {
+	parts, _ := builder.Get(b, "WhereParts")
+	whereParts, _ := parts.([]sq.Sqlizer)
+	return CheckWhere(ctx, whereParts)
+}
+
+// isTautology recognizes what squirrel renders for empty conditions such as sq.Eq{} or sq.And{}
+func isTautology(sql string) bool {
+	normalized := strings.NewReplacer("(", "", ")", "", " ", "").Replace(strings.ToUpper(sql))
+	for _, term := range strings.Split(normalized, "AND") {
+		if term != "" && term != "1=1" && term != "TRUE" {
+			return false
+		}
+	}
+	return true
+}
+
+// execLimited runs an UPDATE or DELETE honoring WithMaxAffectedRows. Outside of a transaction the statement gets
+// its own one so it can be rolled back, inside one the error aborts the caller's transaction.
+func (pg PG) execLimited(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error) {
+	limit, limited := MaxAffectedRows(ctx)
+	tx, inTx := ctx.Value(TxKey).(pgx.Tx)
+	if !limited {
+		if inTx {
+			return tx.Exec(ctx, query, args...)
+		}
+		return pg.API.Exec(ctx, query, args...)
+	}
+
+	ownTx := !inTx
+	if ownTx {
+		var err error
+		if tx, err = pg.API.Begin(ctx); err != nil {
+			return pgconn.CommandTag{}, err
+		}
+		defer func() {
+			_ = tx.Rollback(context.WithoutCancel(ctx)) // no-op after commit
+		}()
+	}
+	tag, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		return tag, err
+	}
+	if tag.RowsAffected() > limit {
+		return tag, &TooManyRowsAffectedError{Limit: limit, Affected: tag.RowsAffected()}
+	}
+	if ownTx {
+		err = tx.Commit(ctx)
+	}
+	return tag, err
+}
+
+// queryRowLimited runs an UPDATE ... RETURNING honoring WithMaxAffectedRows the way execLimited does, the first
+// returned row is kept to be scanned once the statement is checked
+func (pg PG) queryRowLimited(ctx context.Context, limit int64, query string, args ...interface{}) pgx.Row {
+	tx, inTx := ctx.Value(TxKey).(pgx.Tx)
+	if !inTx {
+		var err error
+		if tx, err = pg.API.Begin(ctx); err != nil {
+			return errRow{err}
+		}
+		defer func() {
+			_ = tx.Rollback(context.WithoutCancel(ctx)) // no-op after commit
+		}()
+	}
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return errRow{err}
+	}
+	defer rows.Close()
+	var row pgx.Row = errRow{pgx.ErrNoRows}
+	if rows.Next() {
+		values := make([][]byte, len(rows.RawValues()))
+		for i, value := range rows.RawValues() {
+			// keeps nil for NULL apart from empty values
+			values[i] = bytes.Clone(value)
+		}
+		row = bufferedRow{
+			typeMap: rows.Conn().TypeMap(),
+			fields:  append([]pgconn.FieldDescription(nil), rows.FieldDescriptions()...),
+			values:  values,
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return errRow{err}
+	}
+	if affected := rows.CommandTag().RowsAffected(); affected > limit {
+		return errRow{&TooManyRowsAffectedError{Limit: limit, Affected: affected}}
+	}
+	if !inTx {
+		if err = tx.Commit(ctx); err != nil {
+			return errRow{err}
+		}
+	}
+	return row
+}
+
+// bufferedRow is a row read before its statement completed
+type bufferedRow struct {
+	typeMap *pgtype.Map
+	fields  []pgconn.FieldDescription
+	values  [][]byte
+}
+
+func (r bufferedRow) Scan(dest ...any) error {
+	return pgx.ScanRow(r.typeMap, r.fields, r.values, dest...)
+}
+
+// errRow reports an error from Scan, used where a pgx.Row has to be returned without running a query
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(...any) error {
+	return r.err
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
 	"github.com/simpleGorm/pg/internal/logger"
 	"github.com/simpleGorm/pg/internal/prettier"
 	"github.com/simpleGorm/pg/pkg/transaction"
@@ -15,7 +16,9 @@ import (
 type key string
 
 const (
-	TxKey key = "tx"
+	TxKey            = transaction.TxKey
+	txOptionsKey key = "tx_options"
+	deferredKey  key = "deferred_constraints"
 )
 
 type PG struct {
@@ -31,12 +34,13 @@ func (pg PG) ExecDelete(ctx context.Context, builder sq.DeleteBuilder) int64 {
 	log.Printf("[ExecDelete] query: %s", query)
 	log.Printf("[ExecDelete] args: %+v", args)
 	log.Printf("[ExecDelete] err: %+v", err)
-	tx, ok := ctx.Value(TxKey).(pgx.Tx)
-	var tag pgconn.CommandTag
-	if ok {
-		tag, err = tx.Exec(ctx, query, args...)
-	} else {
-		tag, err = pg.API.Exec(ctx, query, args...)
+	if err = checkBuilderWhere(ctx, builder); err != nil {
+		panic(err)
+	}
+	tag, err := pg.execLimited(ctx, query, args...)
+	var tooMany *TooManyRowsAffectedError
+	if errors.As(err, &tooMany) {
+		panic(err)
 	}
 	if err != nil {
 		log.Printf("err: %+v", err)
@@ -54,12 +58,13 @@ func (pg PG) ExecUpdate(ctx context.Context, builder sq.UpdateBuilder) int64 {
 	logger.Logger().Info("[ExecUpdate] query: %s", query)
 	logger.Logger().Info("[ExecUpdate] args: %+v", args)
 	logger.Logger().Info("[ExecUpdate] err: %+v", err)
-	tx, ok := ctx.Value(TxKey).(pgx.Tx)
-	var tag pgconn.CommandTag
-	if ok {
-		tag, err = tx.Exec(ctx, query, args...)
-	} else {
-		tag, err = pg.API.Exec(ctx, query, args...)
+	if err = checkBuilderWhere(ctx, builder); err != nil {
+		panic(err)
+	}
+	tag, err := pg.execLimited(ctx, query, args...)
+	var tooMany *TooManyRowsAffectedError
+	if errors.As(err, &tooMany) {
+		panic(err)
 	}
 	if err != nil {
 		log.Panic(err)
@@ -135,10 +140,16 @@ func (pg PG) UpdateReturning(ctx context.Context, builder sq.UpdateBuilder) pgx.
 	if err != nil {
 		panic(err)
 	}
+	if err = checkBuilderWhere(ctx, builder); err != nil {
+		return errRow{err}
+	}
 
 	logger.Logger().Info("Generated SQL query:", query)
 	logger.Logger().Info("Arguments:", args)
 
+	if limit, limited := MaxAffectedRows(ctx); limited {
+		return pg.queryRowLimited(ctx, limit, query, args...)
+	}
 	tx, ok := ctx.Value(TxKey).(pgx.Tx)
 	if ok {
 		return tx.QueryRow(ctx, query, args...)
@@ -206,6 +217,10 @@ func (pg PG) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, erro
 	return pg.API.BeginTx(ctx, txOptions)
 }
 
+func (pg PG) Acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	return pg.API.Acquire(ctx)
+}
+
 func (pg PG) Ping(ctx context.Context) error {
 	return pg.API.Ping(ctx)
 }
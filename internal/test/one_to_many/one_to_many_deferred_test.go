@@ -0,0 +1,68 @@
+package oneToMany_entity_repository_test
+
+import (
+	"context"
+	"github.com/simpleGorm/pg/internal/test/one_to_many/test_repository"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDeferredConstraints(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+
+	parentRepository := test_repository.NewParentEntityRepository(dbClient)
+	child1Repository := test_repository.NewChild1EntityRepository(dbClient)
+	deferred := transaction.TxOptions{DeferConstraints: []string{"test_child1_parent_fk"}}
+
+	// the child goes first, the foreign key is checked at commit
+	err := dbClient.RunTransaction(ctx, deferred, func(ctx context.Context) error {
+		child1Repository.Create(ctx, "TYPE1", 1)
+		parentRepository.Create(ctx, "PARENT")
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = dbClient.RunTransaction(ctx, transaction.TxOptions{DeferConstraints: []string{transaction.AllConstraints}},
+		func(ctx context.Context) error {
+			child1Repository.Create(ctx, "TYPE1", 100)
+			return nil
+		})
+	var violation *transaction.ConstraintViolationError
+	require.ErrorAs(t, err, &violation)
+	require.Equal(t, "test_child1_parent_fk", violation.Constraint)
+
+	// a nested call checks its deferred constraints when it completes, the outer transaction keeps checking immediately
+	err = dbClient.RunTransaction(ctx, transaction.TxOptions{}, func(ctx context.Context) error {
+		err := dbClient.RunTransaction(ctx, deferred, func(ctx context.Context) error {
+			child1Repository.Create(ctx, "TYPE1", 2)
+			parentRepository.Create(ctx, "PARENT")
+			return nil
+		})
+		require.NoError(t, err)
+
+		err = dbClient.RunTransaction(ctx, deferred, func(ctx context.Context) error {
+			child1Repository.Create(ctx, "TYPE1", 100)
+			return nil
+		})
+		require.ErrorAs(t, err, &violation)
+
+		err = dbClient.RunTransaction(ctx, transaction.TxOptions{}, func(ctx context.Context) error {
+			child1Repository.Create(ctx, "TYPE1", 100)
+			return nil
+		})
+		require.Error(t, err)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// deferring all constraints can't be undone when the nested call completes
+	err = dbClient.RunTransaction(ctx, transaction.TxOptions{}, func(ctx context.Context) error {
+		return dbClient.RunTransaction(ctx, transaction.TxOptions{DeferConstraints: []string{transaction.AllConstraints}},
+			func(ctx context.Context) error {
+				return nil
+			})
+	})
+	require.ErrorIs(t, err, transaction.ErrIncompatibleTransaction)
+}
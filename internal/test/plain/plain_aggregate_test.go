@@ -0,0 +1,31 @@
+package plain_test
+
+import (
+	"github.com/Masterminds/squirrel"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/test/plain"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAggregates(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+
+	myRepository := plain.NewTestPlainEntityRepository(dbClient)
+	for i := 1; i <= 3; i++ {
+		myRepository.Create(ctx, i, "aggregate")
+	}
+	myRepository.Create(ctx, 10, "other")
+	byField2 := squirrel.Eq{plain.Entity_field2: "aggregate"}
+
+	require.Equal(t, int64(3), myRepository.Count(ctx, byField2))
+	require.Equal(t, int64(4), myRepository.Count(ctx, nil))
+	require.True(t, myRepository.Exists(ctx, byField2))
+	require.False(t, myRepository.Exists(ctx, squirrel.Eq{plain.Entity_field2: "---"}))
+	require.Equal(t, int64(6), pg.Sum[plain.TestPlainEntity, int64](ctx, myRepository.Repository, plain.Entity_field1, byField2))
+	require.Equal(t, int64(1), pg.Min[plain.TestPlainEntity, int64](ctx, myRepository.Repository, plain.Entity_field1, byField2))
+	require.Equal(t, int64(10), pg.Max[plain.TestPlainEntity, int64](ctx, myRepository.Repository, plain.Entity_field1, nil))
+	require.Equal(t, map[string]int64{"aggregate": 3, "other": 1},
+		pg.CountBy[plain.TestPlainEntity, string](ctx, myRepository.Repository, plain.Entity_field2, nil))
+}
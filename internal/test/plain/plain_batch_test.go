@@ -0,0 +1,59 @@
+package plain_test
+
+import (
+	"context"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/test/plain"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestForEachBatch(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+
+	myRepository := plain.NewTestPlainEntityRepository(dbClient)
+	byBatch := squirrel.Eq{plain.Entity_field2: "batch"}
+	var batchIDs []int64
+	for i := 0; i < 5; i++ {
+		batchIDs = append(batchIDs, myRepository.Create(ctx, i, "batch"))
+	}
+
+	// a retried batch is read again, the checkpoint covers committed batches only
+	var processed []int64
+	var checkpoints []pg.BatchProgress
+	failed := false
+	err := myRepository.ForEachBatchWithOptions(ctx, byBatch, 2, pg.BatchOptions{
+		Transaction: &transaction.TxOptions{Retry: &transaction.RetryPolicy{MaxAttempts: 2}},
+		OnProgress:  func(progress pg.BatchProgress) { checkpoints = append(checkpoints, progress) },
+	}, func(ctx context.Context, batch []plain.TestPlainEntity) error {
+		if len(checkpoints) == 1 && !failed {
+			failed = true
+			return &pgconn.PgError{Code: transaction.SerializationFailure}
+		}
+		for _, entity := range batch {
+			processed = append(processed, entity.ID)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.True(t, failed)
+	require.Equal(t, batchIDs, processed)
+	require.Equal(t, pg.BatchProgress{Batches: 3, Processed: 5, LastID: batchIDs[4]}, checkpoints[2])
+	require.Equal(t, batchIDs[1], checkpoints[0].LastID)
+
+	// a resumed run starts after the checkpoint
+	processed = nil
+	err = myRepository.ForEachBatchWithOptions(ctx, byBatch, 2, pg.BatchOptions{ResumeAfter: batchIDs[2]},
+		func(ctx context.Context, batch []plain.TestPlainEntity) error {
+			for _, entity := range batch {
+				processed = append(processed, entity.ID)
+			}
+			return nil
+		})
+	require.NoError(t, err)
+	require.Equal(t, batchIDs[3:], processed)
+}
@@ -0,0 +1,44 @@
+package plain_test
+
+import (
+	"github.com/Masterminds/squirrel"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/test/plain"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestUpdatableColumns(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+
+	myRepository := plain.NewTestPlainEntityRepository(dbClient)
+	id := myRepository.Create(ctx, 1, "columns")
+	fields := map[string]interface{}{plain.Entity_field2: "updated_field2"}
+
+	require.Panics(t, func() {
+		myRepository.Update(ctx, map[string]interface{}{plain.Entity_id: 100}, id)
+	})
+	require.Panics(t, func() {
+		myRepository.Update(ctx, map[string]interface{}{"field2 = 'x', field1": 1}, id)
+	})
+	require.Equal(t, int64(1), myRepository.Update(ctx, fields, id))
+
+	// without insert columns nothing is updatable unless declared
+	undeclared := myRepository.Repository
+	undeclared.InsertBuilder = squirrel.Insert(plain.TABLE_NAME).PlaceholderFormat(squirrel.Dollar)
+	require.Panics(t, func() {
+		undeclared.Update(ctx, map[string]interface{}{"field2 = 'x', field1": 1}, id)
+	})
+	require.Panics(t, func() {
+		undeclared.Update(ctx, fields, id)
+	})
+	undeclared.UpdatableColumns = []string{plain.Entity_field2}
+	require.Equal(t, int64(1), undeclared.Update(ctx, fields, id))
+
+	// a patch updates only the fields it sets
+	require.Equal(t, int64(1), myRepository.ApplyPatch(ctx, plain.TestPlainEntityPatch{Field2: pg.Some("patched")}, id))
+	patched := myRepository.GetById(ctx, id)
+	require.Equal(t, "patched", patched.Field2)
+	require.Equal(t, int64(1), patched.Field1)
+}
@@ -0,0 +1,45 @@
+package plain_test
+
+import (
+	"context"
+	"github.com/Masterminds/squirrel"
+	"github.com/simpleGorm/pg/internal/test/plain"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+
+	myRepository := plain.NewTestPlainEntityRepository(dbClient)
+	for i := 0; i < 3; i++ {
+		myRepository.Create(ctx, i, "cursor")
+	}
+
+	// the cursor opens its own transaction, fetching two rows per round trip
+	cursorBuilder := myRepository.SelectBuilder.Where(squirrel.Eq{plain.Entity_field2: "cursor"}).OrderBy(plain.Entity_id)
+	var streamed []int64
+	for entity, err := range myRepository.Cursor(ctx, cursorBuilder, 2) {
+		require.NoError(t, err)
+		streamed = append(streamed, entity.Field1)
+	}
+	require.Equal(t, []int64{0, 1, 2}, streamed)
+	for entity, err := range myRepository.Cursor(ctx, cursorBuilder, 2) {
+		require.NoError(t, err)
+		require.Equal(t, int64(0), entity.Field1)
+		break
+	}
+
+	// the loop body may use the transaction holding the cursor
+	err := dbClient.RunTransaction(ctx, transaction.TxOptions{}, func(ctx context.Context) error {
+		for entity, err := range myRepository.Cursor(ctx, cursorBuilder, 2) {
+			require.NoError(t, err)
+			myRepository.Update(ctx, map[string]interface{}{plain.Entity_field2: "cursor_done"}, entity.ID)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, myRepository.GetBy(ctx, squirrel.Eq{plain.Entity_field2: "cursor_done"}), 3)
+}
@@ -0,0 +1,26 @@
+package plain_test
+
+import (
+	"github.com/Masterminds/squirrel"
+	"github.com/simpleGorm/pg/internal/test/plain"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDeletes(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+
+	myRepository := plain.NewTestPlainEntityRepository(dbClient)
+	for i := 0; i < 5; i++ {
+		myRepository.Create(ctx, i, "to_delete")
+	}
+	byField2 := squirrel.Eq{plain.Entity_field2: "to_delete"}
+
+	deleted := myRepository.DeleteReturning(ctx, squirrel.Eq{plain.Entity_field1: 0, plain.Entity_field2: "to_delete"})
+	require.Len(t, deleted, 1)
+	require.Equal(t, int64(0), deleted[0].Field1)
+	require.Equal(t, int64(1), myRepository.DeleteBy(ctx, squirrel.Eq{plain.Entity_field1: 1}))
+	require.Equal(t, int64(3), myRepository.DeleteInBatches(ctx, byField2, 2))
+	require.Equal(t, int64(0), myRepository.DeleteBy(ctx, byField2))
+}
@@ -26,12 +26,51 @@ type TestPlainEntity struct {
 	ID     int64 // ID field is mandatory
 	Field1 int64
 	Field2 string
+	pg.EventRecorder
+}
+
+// TestPlainEntityRenamed is recorded by Rename
+type TestPlainEntityRenamed struct {
+	ID     int64
+	Field2 string
+}
+
+func (p *TestPlainEntity) Rename(field2 string) {
+	p.Field2 = field2
+	p.Record(TestPlainEntityRenamed{ID: p.ID, Field2: field2})
 }
 
 func (p TestPlainEntity) GetID() int64 {
 	return p.ID
 }
 
+func (p TestPlainEntity) SeekValues(columns []string) []any {
+	values := make([]any, len(columns))
+	for i, column := range columns {
+		switch column {
+		case Entity_id:
+			values[i] = p.ID
+		case Entity_field1:
+			values[i] = p.Field1
+		case Entity_field2:
+			values[i] = p.Field2
+		}
+	}
+	return values
+}
+
+type TestPlainEntityPatch struct {
+	Field1 pg.Optional[int64]
+	Field2 pg.Optional[string]
+}
+
+func (p TestPlainEntityPatch) Changes() pg.Changes {
+	changes := pg.Changes{}
+	pg.SetIf(changes, Entity_field1, p.Field1)
+	pg.SetIf(changes, Entity_field2, p.Field2)
+	return changes
+}
+
 type TestPlainEntityRepository struct {
 	pg.Repository[TestPlainEntity]
 }
@@ -0,0 +1,67 @@
+package plain_test
+
+import (
+	"context"
+	"github.com/Masterminds/squirrel"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/test/plain"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDomainEvents(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+
+	myRepository := plain.NewTestPlainEntityRepository(dbClient)
+	myRepository.Events = pg.NewEventBus()
+
+	var inTx, afterCommit []string
+	rejecting := true
+	pg.Subscribe(myRepository.Events, pg.Sync, func(ctx context.Context, event plain.TestPlainEntityRenamed) error {
+		inTx = append(inTx, event.Field2)
+		if event.Field2 == "rejected" && rejecting {
+			return errors.New("rejected")
+		}
+		return nil
+	})
+	pg.Subscribe(myRepository.Events, pg.AfterCommit, func(ctx context.Context, event plain.TestPlainEntityRenamed) error {
+		afterCommit = append(afterCommit, event.Field2)
+		return nil
+	})
+
+	entity := plain.TestPlainEntity{Field1: 1}
+	entity.Rename("created")
+	entity.ID = myRepository.CreateEntity(ctx, &entity, entity.Field1, entity.Field2)
+	require.Equal(t, []string{"created"}, inTx)
+	require.Equal(t, []string{"created"}, afterCommit)
+	require.Empty(t, entity.PullEvents())
+
+	// after commit handlers wait for the outer transaction and are dropped with it
+	err := dbClient.RunTransaction(ctx, transaction.TxOptions{}, func(ctx context.Context) error {
+		entity.Rename("renamed")
+		myRepository.UpdateEntity(ctx, &entity, map[string]interface{}{plain.Entity_field2: entity.Field2})
+		require.Equal(t, []string{"created"}, afterCommit)
+		return errors.New("abort")
+	})
+	require.Error(t, err)
+	require.Equal(t, []string{"created", "renamed"}, inTx)
+	require.Equal(t, []string{"created"}, afterCommit)
+
+	// a failing sync handler rolls the save back
+	entity.Rename("rejected")
+	require.Panics(t, func() {
+		myRepository.UpdateEntity(ctx, &entity, map[string]interface{}{plain.Entity_field2: entity.Field2})
+	})
+	require.Equal(t, int64(1), myRepository.Count(ctx, squirrel.Eq{plain.Entity_field2: "created"}))
+	require.Equal(t, []string{"created"}, afterCommit)
+
+	// the events of the rolled back saves are dispatched by the retry
+	rejecting = false
+	myRepository.UpdateEntity(ctx, &entity, map[string]interface{}{plain.Entity_field2: entity.Field2})
+	require.Equal(t, int64(1), myRepository.Count(ctx, squirrel.Eq{plain.Entity_field2: "rejected"}))
+	require.Equal(t, []string{"created", "renamed", "rejected"}, afterCommit)
+	require.Empty(t, entity.PullEvents())
+}
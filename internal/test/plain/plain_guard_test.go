@@ -0,0 +1,49 @@
+package plain_test
+
+import (
+	"github.com/Masterminds/squirrel"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/test/plain"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestStatementGuard(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+
+	myRepository := plain.NewTestPlainEntityRepository(dbClient)
+	for i := 0; i < 5; i++ {
+		myRepository.Create(ctx, i, "guarded")
+	}
+	byField2 := squirrel.Eq{plain.Entity_field2: "guarded"}
+	fields := map[string]interface{}{plain.Entity_field2: "guarded"}
+
+	// statements without WHERE clause need AllowUnbounded
+	require.PanicsWithValue(t, pg.ErrUnboundedStatement, func() {
+		myRepository.UpdateCollection(ctx, fields, squirrel.And{})
+	})
+	require.PanicsWithValue(t, pg.ErrUnboundedStatement, func() {
+		myRepository.DeleteBy(ctx, squirrel.Eq{})
+	})
+	require.Equal(t, int64(5), myRepository.UpdateCollection(pg.AllowUnbounded(ctx), fields, squirrel.And{}))
+
+	// statements over the limit are rolled back
+	require.Panics(t, func() {
+		myRepository.UpdateCollection(pg.WithMaxAffectedRows(ctx, 0), fields, byField2)
+	})
+	require.Panics(t, func() {
+		myRepository.DeleteReturning(pg.WithMaxAffectedRows(ctx, 3), byField2)
+	})
+	require.Equal(t, int64(5), myRepository.Count(ctx, byField2))
+
+	bump := squirrel.Update(plain.TABLE_NAME).Set(plain.Entity_field1, squirrel.Expr(plain.Entity_field1+" + 10")).
+		Where(byField2).
+		Suffix("RETURNING " + plain.Entity_id + ", " + plain.Entity_field1 + ", " + plain.Entity_field2)
+	require.Panics(t, func() {
+		myRepository.UpdateReturning(pg.WithMaxAffectedRows(ctx, 3), bump)
+	})
+	require.Equal(t, int64(0), myRepository.Count(ctx, squirrel.GtOrEq{plain.Entity_field1: 10}))
+	bumped := myRepository.UpdateReturning(pg.WithMaxAffectedRows(ctx, 1), bump.Where(squirrel.Eq{plain.Entity_field1: 4}))
+	require.Equal(t, int64(14), bumped.(*plain.TestPlainEntity).Field1)
+}
@@ -0,0 +1,87 @@
+package plain_test
+
+import (
+	"context"
+	"github.com/Masterminds/squirrel"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/test/plain"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/simpleGorm/pg/pkg/idempotency"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestIdempotency(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+	require.NoError(t, idempotency.Migrate(ctx, dbClient))
+	repository := plain.NewTestPlainEntityRepository(dbClient)
+
+	calls := 0
+	create := func(field2 string) func(ctx context.Context) (int64, error) {
+		return func(ctx context.Context) (int64, error) {
+			calls++
+			return repository.Create(ctx, 1, field2), nil
+		}
+	}
+
+	first, err := idempotency.Run(ctx, dbClient, "create-1", time.Hour, create("idempotent"))
+	require.NoError(t, err)
+	replayed, err := idempotency.Run(ctx, dbClient, "create-1", time.Hour, create("idempotent"))
+	require.NoError(t, err)
+	require.Equal(t, first, replayed)
+	require.Equal(t, 1, calls)
+	require.Equal(t, int64(1), repository.Count(ctx, squirrel.Eq{plain.Entity_field2: "idempotent"}))
+
+	// a failure stores nothing, the key may be retried
+	_, err = idempotency.Run(ctx, dbClient, "create-2", time.Hour, func(ctx context.Context) (int64, error) {
+		repository.Create(ctx, 1, "idempotent_failed")
+		return 0, errors.New("failed")
+	})
+	require.Error(t, err)
+	_, err = idempotency.Run(ctx, dbClient, "create-2", time.Hour, create("idempotent_failed"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), repository.Count(ctx, squirrel.Eq{plain.Entity_field2: "idempotent_failed"}))
+
+	// a concurrent duplicate is rejected while the first run is in flight
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := idempotency.Run(ctx, dbClient, "create-3", time.Hour, func(ctx context.Context) (int64, error) {
+			close(started)
+			<-release
+			return 3, nil
+		})
+		done <- err
+	}()
+	<-started
+	_, err = idempotency.Run(ctx, dbClient, "create-3", time.Hour, create("idempotent_duplicate"))
+	require.ErrorIs(t, err, idempotency.ErrInFlight)
+	close(release)
+	require.NoError(t, <-done)
+
+	// replays of a stored key don't wait for the lock of each other
+	err = dbClient.RunTransaction(ctx, transaction.TxOptions{}, func(txCtx context.Context) error {
+		locked, err := dbClient.TryXactAdvisoryLock(txCtx, pg.AdvisoryKey("idempotency:create-3"))
+		require.NoError(t, err)
+		require.True(t, locked)
+		replayed, err := idempotency.Run(ctx, dbClient, "create-3", time.Hour, create("idempotent_duplicate"))
+		require.NoError(t, err)
+		require.Equal(t, int64(3), replayed)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// an expired key runs again and is purged once expired
+	calls = 0
+	_, err = idempotency.Run(ctx, dbClient, "create-4", -time.Second, create("idempotent_expired"))
+	require.NoError(t, err)
+	_, err = idempotency.Run(ctx, dbClient, "create-4", -time.Second, create("idempotent_expired"))
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+	purged, err := idempotency.Purge(ctx, dbClient)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), purged)
+}
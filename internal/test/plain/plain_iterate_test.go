@@ -0,0 +1,35 @@
+package plain_test
+
+import (
+	"github.com/Masterminds/squirrel"
+	"github.com/simpleGorm/pg/internal/test/plain"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestIterate(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+
+	myRepository := plain.NewTestPlainEntityRepository(dbClient)
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		ids = append(ids, myRepository.Create(ctx, i, "iterate"))
+	}
+	byIterate := squirrel.Eq{plain.Entity_field2: "iterate"}
+
+	var iterated []int64
+	for entity, err := range myRepository.Iterate(ctx, byIterate) {
+		require.NoError(t, err)
+		iterated = append(iterated, entity.ID)
+	}
+	require.ElementsMatch(t, ids, iterated)
+
+	// breaking out of the loop releases the connection
+	for entity, err := range myRepository.Iterate(ctx, byIterate) {
+		require.NoError(t, err)
+		require.Contains(t, ids, entity.ID)
+		break
+	}
+	require.Len(t, myRepository.GetBy(ctx, byIterate), 3)
+}
@@ -0,0 +1,40 @@
+package plain_test
+
+import (
+	"github.com/simpleGorm/pg/internal/closer"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/simpleGorm/pg/pkg/leader"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLeaderElection(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+
+	opts := leader.Options{RetryInterval: 50 * time.Millisecond, CheckInterval: 50 * time.Millisecond}
+	first := leader.New(dbClient, "jobs", opts)
+	second := leader.New(dbClient, "jobs", opts)
+	firstCloser := closer.New()
+	firstCloser.Add(first.Close)
+	defer second.Close()
+
+	first.Start(ctx)
+	require.True(t, <-first.Changes())
+	second.Start(ctx)
+	time.Sleep(200 * time.Millisecond)
+	require.False(t, second.IsLeader())
+
+	firstCloser.CloseAll()
+	firstCloser.Wait()
+	require.False(t, first.IsLeader())
+	require.True(t, <-second.Changes())
+
+	// an elector closed before it started never starts
+	unstarted := leader.New(dbClient, "jobs", opts)
+	require.NoError(t, unstarted.Close())
+	unstarted.Start(ctx)
+	_, open := <-unstarted.Changes()
+	require.False(t, open)
+	require.False(t, unstarted.IsLeader())
+}
@@ -0,0 +1,42 @@
+package plain_test
+
+import (
+	"context"
+	"github.com/Masterminds/squirrel"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/test/plain"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRowLocks(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+
+	myRepository := plain.NewTestPlainEntityRepository(dbClient)
+	id := myRepository.Create(ctx, 1, "locked")
+
+	_, err := myRepository.GetForUpdate(ctx, id)
+	require.ErrorIs(t, err, transaction.ErrNoTransaction)
+
+	err = dbClient.RunTransaction(ctx, transaction.TxOptions{}, func(ctx context.Context) error {
+		locked, err := myRepository.GetForUpdate(ctx, id, pg.NoWait)
+		require.NoError(t, err)
+		require.Equal(t, id, locked.ID)
+		claimed := myRepository.GetBy(ctx, squirrel.Eq{plain.Entity_id: id}, pg.ForUpdate, pg.SkipLocked)
+		require.Len(t, claimed, 1)
+
+		// another transaction skips the locked row or fails right away
+		err = dbClient.RunTransaction(ctx, transaction.TxOptions{Propagation: transaction.RequiresNew},
+			func(ctx context.Context) error {
+				require.Empty(t, myRepository.GetBy(ctx, squirrel.Eq{plain.Entity_id: id}, pg.ForUpdate, pg.SkipLocked))
+				_, err := myRepository.GetForUpdate(ctx, id, pg.NoWait)
+				return err
+			})
+		var lockErr *pg.LockNotAvailableError
+		require.ErrorAs(t, err, &lockErr)
+		return nil
+	})
+	require.NoError(t, err)
+}
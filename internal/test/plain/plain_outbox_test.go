@@ -0,0 +1,123 @@
+package plain_test
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg/internal/test/plain"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/simpleGorm/pg/pkg/outbox"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestOutbox(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+	require.NoError(t, outbox.Migrate(ctx, dbClient))
+	repository := plain.NewTestPlainEntityRepository(dbClient)
+
+	_, err := outbox.Add(ctx, "entities", "1", "outside")
+	require.ErrorIs(t, err, transaction.ErrNoTransaction)
+
+	add := func(fail bool, messages ...[2]string) error {
+		return dbClient.RunTransaction(ctx, transaction.TxOptions{}, func(ctx context.Context) error {
+			repository.Create(ctx, 1, "outbox")
+			for _, message := range messages {
+				_, err := outbox.Add(ctx, "entities", message[0], map[string]string{"value": message[1]})
+				require.NoError(t, err)
+			}
+			if fail {
+				return errors.New("abort")
+			}
+			return nil
+		})
+	}
+	require.Error(t, add(true, [2]string{"a", "rolled back"}))
+	require.NoError(t, add(false, [2]string{"a", "a1"}, [2]string{"a", "a2"}, [2]string{"b", "b1"}))
+
+	failed := false
+	publisher := &outbox.MemoryPublisher{Fail: func(message outbox.Message) error {
+		if message.Key == "a" && !failed {
+			failed = true
+			return errors.New("broker is down")
+		}
+		return nil
+	}}
+	relay := outbox.NewRelay(dbClient, publisher, outbox.RelayOptions{PollInterval: time.Hour, Listen: true,
+		RetryBackoff: time.Millisecond})
+
+	// a failed message holds back the rest of its key
+	published, err := relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, published)
+	time.Sleep(10 * time.Millisecond)
+	published, err = relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, published)
+
+	values := func() []string {
+		var values []string
+		for _, message := range publisher.Messages() {
+			values = append(values, message.Key+":"+string(message.Payload))
+		}
+		return values
+	}
+	require.Equal(t, []string{`b:{"value": "b1"}`, `a:{"value": "a1"}`, `a:{"value": "a2"}`}, values())
+
+	// the notification wakes the relay long before its poll interval
+	relay.Start(ctx)
+	relay.Start(ctx)
+	defer relay.Close()
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, add(false, [2]string{"c", "c1"}))
+	require.Eventually(t, func() bool {
+		return len(publisher.Messages()) == 4
+	}, 5*time.Second, 20*time.Millisecond)
+
+	deleted, err := outbox.Cleanup(ctx, dbClient, -time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), deleted)
+
+	// a closed relay never starts again
+	require.NoError(t, relay.Close())
+	relay.Start(ctx)
+	require.NoError(t, add(false, [2]string{"d", "d1"}))
+	time.Sleep(200 * time.Millisecond)
+	require.Len(t, publisher.Messages(), 4)
+}
+
+func TestOutboxFailingKeyBacksOff(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+	require.NoError(t, outbox.Migrate(ctx, dbClient))
+
+	err := dbClient.RunTransaction(ctx, transaction.TxOptions{}, func(ctx context.Context) error {
+		for _, key := range []string{"a", "a", "a", "b"} {
+			if _, err := outbox.Add(ctx, "entities", key, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	publisher := &outbox.MemoryPublisher{Fail: func(message outbox.Message) error {
+		if message.Key == "a" {
+			return errors.New("broker rejects a")
+		}
+		return nil
+	}}
+	relay := outbox.NewRelay(dbClient, publisher, outbox.RelayOptions{BatchSize: 2, RetryBackoff: time.Hour})
+
+	// the first batch holds only messages of the failing key
+	published, err := relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, published)
+
+	// the backed off key doesn't take the next batch
+	published, err = relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, published)
+	require.Len(t, publisher.Messages(), 1)
+	require.Equal(t, "b", publisher.Messages()[0].Key)
+}
@@ -0,0 +1,36 @@
+package plain_test
+
+import (
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/test/plain"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestProjection(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+
+	myRepository := plain.NewTestPlainEntityRepository(dbClient)
+	id := myRepository.Create(ctx, 10, "projected")
+	myRepository.Create(ctx, 20, "other")
+	byField2 := squirrel.Eq{plain.Entity_field2: "projected"}
+
+	type field2Only struct {
+		ID     int64
+		Field2 string
+	}
+	projection := pg.Project(myRepository.Repository, []string{plain.Entity_id, plain.Entity_field2}, func(row pgx.Row) *field2Only {
+		var dto field2Only
+		if err := row.Scan(&dto.ID, &dto.Field2); err != nil {
+			panic(err)
+		}
+		return &dto
+	})
+	require.Equal(t, []field2Only{{ID: id, Field2: "projected"}}, projection.GetBy(ctx, byField2))
+	require.Len(t, projection.GetAll(ctx), 2)
+
+	require.Equal(t, []int64{id}, pg.Pluck[plain.TestPlainEntity, int64](ctx, myRepository.Repository, plain.Entity_id, byField2))
+}
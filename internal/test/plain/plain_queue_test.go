@@ -0,0 +1,121 @@
+package plain_test
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg/internal/closer"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/simpleGorm/pg/pkg/queue"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+	require.NoError(t, queue.Migrate(ctx, dbClient))
+
+	state := func(id int64) (state string, attempts int) {
+		err := dbClient.QueryRowContext(ctx, pg_api.Query{Name: "state",
+			QueryRaw: "SELECT state, attempts FROM queue_jobs WHERE id = $1"}, id).Scan(&state, &attempts)
+		require.NoError(t, err)
+		return state, attempts
+	}
+
+	type payload struct {
+		Value int `json:"value"`
+	}
+
+	// a rolled back transaction leaves no job behind
+	var rolledBack int64
+	err := dbClient.RunTransaction(ctx, transaction.TxOptions{}, func(ctx context.Context) error {
+		var err error
+		rolledBack, err = queue.Enqueue(ctx, dbClient, "ok", payload{Value: 1}, queue.EnqueueOptions{})
+		require.NoError(t, err)
+		return errors.New("abort")
+	})
+	require.Error(t, err)
+	var exists bool
+	require.NoError(t, dbClient.QueryRowContext(ctx, pg_api.Query{Name: "exists",
+		QueryRaw: "SELECT exists(SELECT 1 FROM queue_jobs WHERE id = $1)"}, rolledBack).Scan(&exists))
+	require.False(t, exists)
+
+	okID, err := queue.Enqueue(ctx, dbClient, "ok", payload{Value: 2}, queue.EnqueueOptions{})
+	require.NoError(t, err)
+	failingID, err := queue.Enqueue(ctx, dbClient, "failing", payload{}, queue.EnqueueOptions{MaxAttempts: 2, Priority: 10})
+	require.NoError(t, err)
+	laterID, err := queue.Enqueue(ctx, dbClient, "ok", payload{Value: 3}, queue.EnqueueOptions{RunAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	var processed atomic.Int64
+	pool := queue.NewPool(dbClient, queue.Config{
+		Concurrency:  2,
+		PollInterval: 20 * time.Millisecond,
+		Backoff:      func(int) time.Duration { return 0 },
+		Handlers: map[string]queue.Handler{
+			"ok": func(ctx context.Context, job queue.Job) error {
+				processed.Add(1)
+				return nil
+			},
+			"failing": func(ctx context.Context, job queue.Job) error {
+				panic("boom")
+			},
+		},
+	})
+	poolCloser := closer.New()
+	poolCloser.Add(pool.Close)
+	pool.Start(ctx)
+
+	require.Eventually(t, func() bool {
+		okState, _ := state(okID)
+		failingState, _ := state(failingID)
+		return okState == queue.StateDone && failingState == queue.StateDead
+	}, 5*time.Second, 20*time.Millisecond)
+	_, attempts := state(failingID)
+	require.Equal(t, 2, attempts)
+
+	poolCloser.CloseAll()
+	poolCloser.Wait()
+	require.Equal(t, int64(1), processed.Load())
+	laterState, _ := state(laterID)
+	require.Equal(t, queue.StatePending, laterState)
+
+	// a closed pool never starts again
+	afterCloseID, err := queue.Enqueue(ctx, dbClient, "ok", payload{Value: 4}, queue.EnqueueOptions{})
+	require.NoError(t, err)
+	pool.Start(ctx)
+	time.Sleep(200 * time.Millisecond)
+	afterCloseState, _ := state(afterCloseID)
+	require.Equal(t, queue.StatePending, afterCloseState)
+
+	// a job outliving its lease on the last attempt is dead lettered, the late result is dropped
+	slowID, err := queue.Enqueue(ctx, dbClient, "slow", payload{}, queue.EnqueueOptions{MaxAttempts: 1})
+	require.NoError(t, err)
+	slowPool := queue.NewPool(dbClient, queue.Config{
+		Concurrency:  2,
+		PollInterval: 20 * time.Millisecond,
+		Lease:        100 * time.Millisecond,
+		Handlers: map[string]queue.Handler{
+			"slow": func(ctx context.Context, job queue.Job) error {
+				time.Sleep(500 * time.Millisecond)
+				return nil
+			},
+		},
+	})
+	slowPool.Start(ctx)
+	require.Eventually(t, func() bool {
+		slowState, _ := state(slowID)
+		return slowState == queue.StateDead
+	}, 5*time.Second, 20*time.Millisecond)
+	require.NoError(t, slowPool.Close())
+	slowState, attempts := state(slowID)
+	require.Equal(t, queue.StateDead, slowState)
+	require.Equal(t, 1, attempts)
+
+	deleted, err := queue.Cleanup(ctx, dbClient, -time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+}
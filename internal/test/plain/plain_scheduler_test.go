@@ -0,0 +1,116 @@
+package plain_test
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/simpleGorm/pg/pkg/scheduler"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCron(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.DateTime, value)
+		require.NoError(t, err)
+		return parsed
+	}
+	next := func(spec string, after string) time.Time {
+		cron, err := scheduler.ParseCron(spec)
+		require.NoError(t, err)
+		return cron.Next(at(after))
+	}
+
+	require.Equal(t, at("2026-03-01 10:01:00"), next("* * * * *", "2026-03-01 10:00:30"))
+	require.Equal(t, at("2026-03-01 10:15:00"), next("*/15 * * * *", "2026-03-01 10:00:00"))
+	require.Equal(t, at("2026-03-02 09:30:00"), next("30 9 * * mon-fri", "2026-03-01 10:00:00"))
+	require.Equal(t, at("2026-04-01 00:00:00"), next("@monthly", "2026-03-01 00:00:00"))
+	// either day field matches when both are restricted
+	require.Equal(t, at("2026-03-08 00:00:00"), next("0 0 15 * 0", "2026-03-01 00:00:00"))
+	require.True(t, next("0 0 30 2 *", "2026-03-01 00:00:00").IsZero())
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "* * * * 8", "*/0 * * * *", "5-1 * * * *"} {
+		_, err := scheduler.ParseCron(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+	require.NoError(t, scheduler.Migrate(ctx, dbClient))
+
+	// the schedules were due while no replica was running
+	_, err := dbClient.ExecContext(ctx, pg_api.Query{Name: "missed", QueryRaw: `INSERT INTO scheduler_schedules (name, spec, next_run_at) VALUES
+         ('all', '* * * * *', date_trunc('minute', now()) - interval '3 minutes'),
+         ('once', '* * * * *', date_trunc('minute', now()) - interval '3 minutes'),
+         ('skip', '@yearly', '2020-01-01')`})
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	fired := map[string][]time.Time{}
+	job := func(name string) scheduler.Job {
+		return func(ctx context.Context, scheduledAt time.Time) error {
+			mu.Lock()
+			defer mu.Unlock()
+			fired[name] = append(fired[name], scheduledAt)
+			if name == "once" {
+				return errors.New("failed")
+			}
+			return nil
+		}
+	}
+
+	// two replicas share the schedules
+	for i := 0; i < 2; i++ {
+		s := scheduler.New(dbClient, scheduler.Options{PollInterval: 20 * time.Millisecond})
+		require.NoError(t, s.Register("all", "* * * * *", scheduler.CatchUpAll, job("all")))
+		require.NoError(t, s.Register("once", "* * * * *", scheduler.CatchUpOnce, job("once")))
+		require.NoError(t, s.Register("skip", "@yearly", scheduler.CatchUpSkip, job("skip")))
+		require.Error(t, s.Register("skip", "@daily", scheduler.CatchUpSkip, job("skip")))
+		require.NoError(t, s.Start(ctx))
+		require.NoError(t, s.Start(ctx))
+		defer s.Close()
+	}
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(fired["all"]) >= 4 && len(fired["once"]) >= 1
+	}, 5*time.Second, 20*time.Millisecond)
+
+	mu.Lock()
+	seen := map[time.Time]bool{}
+	for _, slot := range fired["all"] {
+		require.False(t, seen[slot], "slot %s fired twice", slot)
+		seen[slot] = true
+	}
+	require.Empty(t, fired["skip"])
+	onceSlot := fired["once"][0]
+	mu.Unlock()
+
+	var runErr string
+	require.Eventually(t, func() bool {
+		err := dbClient.QueryRowContext(ctx, pg_api.Query{Name: "run", QueryRaw: `SELECT error FROM scheduler_runs
+             WHERE name = 'once' AND scheduled_at = $1 AND duration_ms IS NOT NULL`}, onceSlot).Scan(&runErr)
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	require.Equal(t, "failed", runErr)
+
+	var skipNext time.Time
+	require.NoError(t, dbClient.QueryRowContext(ctx, pg_api.Query{Name: "skip",
+		QueryRaw: "SELECT next_run_at FROM scheduler_schedules WHERE name = 'skip'"}).Scan(&skipNext))
+	require.True(t, skipNext.After(time.Now()))
+
+	// a closed scheduler never starts again
+	closed := scheduler.New(dbClient, scheduler.Options{PollInterval: 20 * time.Millisecond})
+	require.NoError(t, closed.Register("closed", "* * * * *", scheduler.CatchUpAll, job("closed")))
+	require.NoError(t, closed.Close())
+	require.NoError(t, closed.Start(ctx))
+	var registered bool
+	require.NoError(t, dbClient.QueryRowContext(ctx, pg_api.Query{Name: "registered",
+		QueryRaw: "SELECT exists(SELECT 1 FROM scheduler_schedules WHERE name = 'closed')"}).Scan(&registered))
+	require.False(t, registered)
+}
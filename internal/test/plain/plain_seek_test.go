@@ -0,0 +1,64 @@
+package plain_test
+
+import (
+	"github.com/Masterminds/squirrel"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/test/plain"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSeek(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+
+	myRepository := plain.NewTestPlainEntityRepository(dbClient)
+	for i := 0; i < 5; i++ {
+		myRepository.Create(ctx, i%2, "seek")
+	}
+	where := squirrel.Eq{plain.Entity_field2: "seek"}
+	orderBy := []pg.SortKey{{Column: plain.Entity_field1, Desc: true}, {Column: plain.Entity_id}}
+
+	// field1 desc, id asc: (1,2) (1,4) (0,1) (0,3) (0,5)
+	page, err := myRepository.Seek(ctx, where, pg.SeekRequest{Limit: 2, OrderBy: orderBy})
+	require.NoError(t, err)
+	require.Equal(t, []int64{2, 4}, ids(page.Items))
+	require.Empty(t, page.Prev)
+	require.NotEmpty(t, page.Next)
+
+	page, err = myRepository.Seek(ctx, where, pg.SeekRequest{After: page.Next, Limit: 2, OrderBy: orderBy})
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 3}, ids(page.Items))
+
+	last, err := myRepository.Seek(ctx, where, pg.SeekRequest{After: page.Next, Limit: 2, OrderBy: orderBy})
+	require.NoError(t, err)
+	require.Equal(t, []int64{5}, ids(last.Items))
+	require.Empty(t, last.Next)
+
+	prev, err := myRepository.Seek(ctx, where, pg.SeekRequest{Before: last.Prev, Limit: 2, OrderBy: orderBy})
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 3}, ids(prev.Items))
+	require.Equal(t, page.Prev, prev.Prev)
+
+	// single direction uses the row value comparison
+	byId, err := myRepository.Seek(ctx, where, pg.SeekRequest{Limit: 3})
+	require.NoError(t, err)
+	byId, err = myRepository.Seek(ctx, where, pg.SeekRequest{After: byId.Next, Limit: 3})
+	require.NoError(t, err)
+	require.Equal(t, []int64{4, 5}, ids(byId.Items))
+
+	_, err = myRepository.Seek(ctx, where, pg.SeekRequest{After: "garbage"})
+	require.ErrorIs(t, err, pg.ErrInvalidCursor)
+
+	// sort keys are checked against the selected columns before they reach the SQL
+	_, err = myRepository.Seek(ctx, where, pg.SeekRequest{OrderBy: []pg.SortKey{{Column: "(SELECT pg_sleep(1))"}}})
+	require.ErrorIs(t, err, pg.ErrUnknownSortColumn)
+}
+
+func ids(entities []plain.TestPlainEntity) []int64 {
+	result := make([]int64, len(entities))
+	for i, entity := range entities {
+		result[i] = entity.ID
+	}
+	return result
+}
@@ -0,0 +1,265 @@
+package plain_test
+
+import (
+	"context"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"github.com/simpleGorm/pg/internal/test/plain"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTransactions(t *testing.T) {
+	ctx, dbClient := test_utils.NewTestDBClient(t)
+
+	myRepository := plain.NewTestPlainEntityRepository(dbClient)
+	txOptions := transaction.TxOptions{IsoLevel: transaction.ReadCommitted}
+	count := func(field2 string) int64 {
+		return myRepository.Count(ctx, squirrel.Eq{plain.Entity_field2: field2})
+	}
+
+	t.Run("nested failure rolls back to savepoint", func(t *testing.T) {
+		err := dbClient.RunTransaction(ctx, txOptions, func(ctx context.Context) error {
+			myRepository.Create(ctx, 1, "nested_outer")
+			innerErr := dbClient.RunTransaction(ctx, txOptions, func(ctx context.Context) error {
+				myRepository.Create(ctx, 2, "nested_inner")
+				return errors.New("inner failure")
+			})
+			require.Error(t, innerErr)
+
+			innerErr = dbClient.RunTransaction(ctx, txOptions, func(ctx context.Context) error {
+				myRepository.Create(ctx, 3, "nested_inner")
+				panic("inner panic")
+			})
+			require.Error(t, innerErr)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), count("nested_outer"))
+		require.Equal(t, int64(0), count("nested_inner"))
+	})
+
+	t.Run("explicit savepoint", func(t *testing.T) {
+		err := dbClient.RunTransaction(ctx, txOptions, func(ctx context.Context) error {
+			require.NoError(t, transaction.Savepoint(ctx, "kept", func(ctx context.Context) error {
+				myRepository.Create(ctx, 1, "savepoint_kept")
+				return nil
+			}))
+			require.Error(t, transaction.Savepoint(ctx, "dropped", func(ctx context.Context) error {
+				myRepository.Create(ctx, 1, "savepoint_dropped")
+				return errors.New("dropped")
+			}))
+			// a panic rolls back to the savepoint and keeps the stack of the panicking frame
+			err := transaction.Savepoint(ctx, "panicked", func(ctx context.Context) error {
+				myRepository.Create(ctx, 1, "savepoint_panicked")
+				myRepository.GetBy(ctx, squirrel.Expr("no_such_column = 1"))
+				return nil
+			})
+			var panicErr *transaction.PanicError
+			require.ErrorAs(t, err, &panicErr)
+			require.Contains(t, string(panicErr.Stack), "QueryContextSelect")
+			require.Contains(t, string(panicErr.Stack), "pg_api.go")
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), count("savepoint_kept"))
+		require.Equal(t, int64(0), count("savepoint_dropped"))
+		require.Equal(t, int64(0), count("savepoint_panicked"))
+
+		require.ErrorIs(t, transaction.Savepoint(ctx, "none", func(ctx context.Context) error { return nil }),
+			transaction.ErrNoTransaction)
+	})
+
+	t.Run("propagation", func(t *testing.T) {
+		require.ErrorIs(t, dbClient.RunTransaction(ctx, transaction.TxOptions{Propagation: transaction.Mandatory},
+			func(ctx context.Context) error { return nil }), transaction.ErrNoTransaction)
+
+		err := dbClient.RunTransaction(ctx, txOptions, func(ctx context.Context) error {
+			require.ErrorIs(t, dbClient.RunTransaction(ctx, transaction.TxOptions{Propagation: transaction.Never},
+				func(ctx context.Context) error { return nil }), transaction.ErrTransactionExists)
+			require.ErrorIs(t, dbClient.RunTransaction(ctx, transaction.TxOptions{IsoLevel: transaction.Serializable},
+				func(ctx context.Context) error { return nil }), transaction.ErrIncompatibleTransaction)
+
+			// the separate transaction commits although the outer one rolls back
+			require.NoError(t, dbClient.RunTransaction(ctx, transaction.TxOptions{Propagation: transaction.RequiresNew},
+				func(ctx context.Context) error {
+					myRepository.Create(ctx, 1, "requires_new")
+					return nil
+				}))
+			return dbClient.RunTransaction(ctx, transaction.TxOptions{Propagation: transaction.Required},
+				func(ctx context.Context) error {
+					myRepository.Create(ctx, 1, "required")
+					return errors.New("rollback everything")
+				})
+		})
+		require.Error(t, err)
+		require.Equal(t, int64(1), count("requires_new"))
+		require.Equal(t, int64(0), count("required"))
+	})
+
+	t.Run("retry serialization failures", func(t *testing.T) {
+		attempts := 0
+		retryOptions := transaction.TxOptions{
+			IsoLevel: transaction.Serializable,
+			Retry:    &transaction.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+		}
+		err := dbClient.RunTransaction(ctx, retryOptions, func(ctx context.Context) error {
+			attempts++
+			myRepository.Create(ctx, attempts, "retry")
+			if attempts < 3 {
+				panic(&pgconn.PgError{Code: transaction.SerializationFailure})
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 3, attempts)
+		require.Equal(t, int64(1), count("retry"))
+
+		attempts = 0
+		err = dbClient.RunTransaction(ctx, retryOptions, func(ctx context.Context) error {
+			attempts++
+			return errors.New("not retryable")
+		})
+		require.Error(t, err)
+		require.Equal(t, 1, attempts)
+	})
+
+	t.Run("lifecycle hooks", func(t *testing.T) {
+		var events []string
+		record := func(event string) func(ctx context.Context) {
+			return func(ctx context.Context) { events = append(events, event) }
+		}
+
+		err := dbClient.RunTransaction(ctx, txOptions, func(ctx context.Context) error {
+			transaction.AfterCommit(ctx, record("committed"))
+			transaction.AfterRollback(ctx, record("never"))
+			_ = transaction.Savepoint(ctx, "hooks", func(ctx context.Context) error {
+				transaction.AfterCommit(ctx, record("never"))
+				transaction.AfterRollback(ctx, record("savepoint rolled back"))
+				return errors.New("rollback savepoint")
+			})
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"savepoint rolled back", "committed"}, events)
+
+		events = nil
+		err = dbClient.RunTransaction(ctx, txOptions, func(ctx context.Context) error {
+			transaction.AfterCommit(ctx, record("never"))
+			transaction.AfterRollback(ctx, record("rolled back"))
+			return errors.New("rollback")
+		})
+		require.Error(t, err)
+		require.Equal(t, []string{"rolled back"}, events)
+
+		events = nil
+		transaction.AfterCommit(ctx, record("immediately"))
+		require.Equal(t, []string{"immediately"}, events)
+	})
+
+	t.Run("value returning transactions", func(t *testing.T) {
+		id, err := transaction.Do(ctx, dbClient, txOptions, func(ctx context.Context) (int64, error) {
+			return myRepository.Create(ctx, 1, "do"), nil
+		})
+		require.NoError(t, err)
+		entity, err := transaction.DoReadOnly(ctx, dbClient, func(ctx context.Context) (plain.TestPlainEntity, error) {
+			return myRepository.GetById(ctx, id), nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, "do", entity.Field2)
+
+		_, err = transaction.Do(ctx, dbClient, txOptions, func(ctx context.Context) ([]plain.TestPlainEntity, error) {
+			return myRepository.GetBy(ctx, squirrel.Expr("no_such_column = 1")), nil
+		})
+		var panicErr *transaction.PanicError
+		require.ErrorAs(t, err, &panicErr)
+		require.Contains(t, string(panicErr.Stack), "QueryContextSelect")
+		require.Contains(t, string(panicErr.Stack), "pg_api.go")
+		var pgErr *pgconn.PgError
+		require.ErrorAs(t, err, &pgErr)
+	})
+
+	t.Run("session settings", func(t *testing.T) {
+		setting := func(ctx context.Context, name string) string {
+			var value string
+			err := dbClient.QueryRowContext(ctx, pg_api.Query{Name: "setting", QueryRaw: "SELECT current_setting($1, true)"}, name).
+				Scan(&value)
+			require.NoError(t, err)
+			return value
+		}
+		settingsOptions := transaction.TxOptions{
+			StatementTimeout: 1500 * time.Millisecond,
+			Settings:         map[string]string{"app.current_user": "alice"},
+		}
+		err := dbClient.RunTransaction(ctx, settingsOptions, func(ctx context.Context) error {
+			require.Equal(t, "1500ms", setting(ctx, "statement_timeout"))
+			require.Equal(t, "alice", setting(ctx, "app.current_user"))
+
+			// a nested call restores the outer values when its savepoint is released
+			err := dbClient.RunTransaction(ctx, transaction.TxOptions{
+				StatementTimeout: 200 * time.Millisecond,
+				Settings:         map[string]string{"app.current_user": "bob"},
+			}, func(ctx context.Context) error {
+				require.Equal(t, "200ms", setting(ctx, "statement_timeout"))
+				require.Equal(t, "bob", setting(ctx, "app.current_user"))
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, "1500ms", setting(ctx, "statement_timeout"))
+			require.Equal(t, "alice", setting(ctx, "app.current_user"))
+
+			// so does a joining call, after it succeeds or fails
+			for _, result := range []error{nil, errors.New("joined call failed")} {
+				err = dbClient.RunTransaction(ctx, transaction.TxOptions{
+					Propagation:      transaction.Required,
+					StatementTimeout: 300 * time.Millisecond,
+					Settings:         map[string]string{"app.current_user": "carol"},
+				}, func(ctx context.Context) error {
+					require.Equal(t, "300ms", setting(ctx, "statement_timeout"))
+					require.Equal(t, "carol", setting(ctx, "app.current_user"))
+					return result
+				})
+				require.ErrorIs(t, err, result)
+				require.Equal(t, "1500ms", setting(ctx, "statement_timeout"))
+				require.Equal(t, "alice", setting(ctx, "app.current_user"))
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		// SET LOCAL doesn't leak to the pooled connections
+		for i := 0; i < 5; i++ {
+			require.Equal(t, "0", setting(ctx, "statement_timeout"))
+		}
+	})
+
+	t.Run("advisory locks", func(t *testing.T) {
+		key := pg.AdvisoryKey("account:42")
+		lock, ok, err := dbClient.TryAdvisoryLock(ctx, key)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		_, ok, err = dbClient.TryAdvisoryLock(ctx, key)
+		require.NoError(t, err)
+		require.False(t, ok, "lock is held by another session")
+		err = dbClient.RunTransaction(ctx, txOptions, func(ctx context.Context) error {
+			locked, err := dbClient.TryXactAdvisoryLock(ctx, key)
+			require.NoError(t, err)
+			require.False(t, locked)
+			return nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, lock.Release(ctx))
+
+		require.NoError(t, dbClient.WithAdvisoryLock(ctx, key, func(ctx context.Context) error {
+			return nil
+		}))
+		require.ErrorIs(t, dbClient.XactAdvisoryLock(ctx, key), transaction.ErrNoTransaction)
+	})
+}
@@ -0,0 +1,96 @@
+package plain_test
+
+import (
+	"context"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"github.com/simpleGorm/pg/internal/test/plain"
+	"github.com/simpleGorm/pg/internal/test/test_utils"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"github.com/simpleGorm/pg/pkg/twophase"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestTwoPhaseCommit(t *testing.T) {
+	// both participants use the same database, it is enough to exercise the protocol
+	ctx, DSN := test_utils.NewTestDatabase(t)
+	first := test_utils.Connect(ctx, t, DSN)
+	second := test_utils.Connect(ctx, t, DSN)
+
+	coordinator := twophase.NewCoordinator("test",
+		twophase.Participant{Name: "first", DB: first},
+		twophase.Participant{Name: "second", DB: second})
+	require.NoError(t, coordinator.Migrate(ctx))
+
+	firstRepository := plain.NewTestPlainEntityRepository(first)
+	secondRepository := plain.NewTestPlainEntityRepository(second)
+	count := func(field2 string) int64 {
+		return firstRepository.Count(ctx, squirrel.Eq{plain.Entity_field2: field2})
+	}
+
+	err := coordinator.Run(ctx, transaction.TxOptions{}, func(scope twophase.Scope) error {
+		firstRepository.Create(scope.Context("first"), 1, "two_phase")
+		secondRepository.Create(scope.Context("second"), 2, "two_phase")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count("two_phase"))
+
+	err = coordinator.Run(ctx, transaction.TxOptions{}, func(scope twophase.Scope) error {
+		firstRepository.Create(scope.Context("first"), 1, "two_phase_failed")
+		return errors.New("abort")
+	})
+	require.Error(t, err)
+	require.Equal(t, int64(0), count("two_phase_failed"))
+
+	// the options apply to every branch
+	err = coordinator.Run(ctx, transaction.TxOptions{Settings: map[string]string{"app.current_user": "alice"}},
+		func(scope twophase.Scope) error {
+			for _, name := range []string{"first", "second"} {
+				var user string
+				require.NoError(t, first.QueryRowContext(scope.Context(name), pg_api.Query{Name: "setting",
+					QueryRaw: "SELECT current_setting('app.current_user', true)"}).Scan(&user))
+				require.Equal(t, "alice", user)
+			}
+			return nil
+		})
+	require.NoError(t, err)
+
+	// the branches can't commit as part of an outer transaction
+	err = first.RunTransaction(ctx, transaction.TxOptions{}, func(ctx context.Context) error {
+		return coordinator.Run(ctx, transaction.TxOptions{}, func(scope twophase.Scope) error {
+			return nil
+		})
+	})
+	require.ErrorIs(t, err, transaction.ErrTransactionExists)
+
+	// an orphan without commit decision is rolled back by recovery
+	tx, err := first.BeginTx(ctx, pgx.TxOptions{})
+	require.NoError(t, err)
+	firstRepository.Create(pg_api.MakeContextTx(ctx, tx), 1, "two_phase_orphan")
+	_, err = tx.Exec(ctx, "PREPARE TRANSACTION 'test_1_0123456789abcdef_first'")
+	require.NoError(t, err)
+	_ = tx.Commit(ctx)
+
+	// an orphan with commit decision is committed
+	tx, err = first.BeginTx(ctx, pgx.TxOptions{})
+	require.NoError(t, err)
+	firstRepository.Create(pg_api.MakeContextTx(ctx, tx), 1, "two_phase_decided")
+	_, err = tx.Exec(ctx, "PREPARE TRANSACTION 'test_2_0123456789abcdef_first'")
+	require.NoError(t, err)
+	_ = tx.Commit(ctx)
+	_, err = first.ExecContext(ctx, pg_api.Query{Name: "decide",
+		QueryRaw: "INSERT INTO twophase_decisions (gid) VALUES ('test_2_0123456789abcdef')"})
+	require.NoError(t, err)
+
+	require.NoError(t, coordinator.Recover(ctx, 0))
+	require.Equal(t, int64(0), count("two_phase_orphan"))
+	require.Equal(t, int64(1), count("two_phase_decided"))
+	var prepared int
+	require.NoError(t, first.QueryRowContext(ctx, pg_api.Query{Name: "prepared",
+		QueryRaw: "SELECT count(*) FROM pg_prepared_xacts"}).Scan(&prepared))
+	require.Zero(t, prepared)
+}
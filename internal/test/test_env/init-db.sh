@@ -21,9 +21,10 @@ psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "$POSTGRES_DB" <<-E
         id SERIAL PRIMARY KEY,
         type TEXT NOT NULL,
         parent_id INTEGER NOT NULL,
-        FOREIGN KEY (parent_id) REFERENCES test_parent_entity_table(id)
+        CONSTRAINT test_child1_parent_fk FOREIGN KEY (parent_id) REFERENCES test_parent_entity_table(id)
             ON DELETE CASCADE
             ON UPDATE RESTRICT
+            DEFERRABLE INITIALLY IMMEDIATE
     );
 
     CREATE TABLE IF NOT EXISTS test_child2_table (
@@ -0,0 +1,67 @@
+package test_utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/logger"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// templateDB is the database init-db.sh fills, every test gets a copy of it
+const templateDB = "users"
+
+var shared struct {
+	once      sync.Once
+	dsn       string
+	err       error
+	databases atomic.Int64
+}
+
+// NewTestDatabase returns the DSN of a fresh copy of the test database. The postgres container
+// is started by the first test of the package and shared by the others.
+func NewTestDatabase(t *testing.T) (context.Context, string) {
+	logger.SetLogger(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelError})))
+
+	ctx := context.Background()
+	shared.once.Do(func() {
+		// stays when the start fails the test with FailNow
+		shared.err = errors.New("postgres container failed to start")
+		shared.dsn, shared.err = StartPostgresContainer(ctx, t)
+	})
+	require.NoError(t, shared.err)
+
+	admin, err := pgx.Connect(ctx, strings.Replace(shared.dsn, "dbname="+templateDB, "dbname=postgres", 1))
+	require.NoError(t, err)
+	defer admin.Close(ctx)
+
+	name := fmt.Sprintf("test_%d", shared.databases.Add(1))
+	_, err = admin.Exec(ctx, "CREATE DATABASE "+name+" TEMPLATE "+templateDB)
+	require.NoError(t, err)
+	return ctx, strings.Replace(shared.dsn, "dbname="+templateDB, "dbname="+name, 1)
+}
+
+// Connect returns a client of DSN closed when the test ends
+func Connect(ctx context.Context, t *testing.T, DSN string) pg.DbClient {
+	dbClient, err := pg.NewDBClient(ctx, DSN)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = dbClient.Close()
+	})
+	return dbClient
+}
+
+// NewTestDBClient connects to a fresh copy of the test database
+func NewTestDBClient(t *testing.T) (context.Context, pg.DbClient) {
+	ctx, DSN := NewTestDatabase(t)
+	return ctx, Connect(ctx, t, DSN)
+}
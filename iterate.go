@@ -0,0 +1,78 @@
+package pg
+
+import (
+	"context"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"iter"
+)
+
+// Iterate streams entities matching where one row at a time instead of loading them all into a slice.
+// Breaking out of the loop closes the underlying rows. Relations are not loaded for streamed entities.
+func (repo Repository[T]) Iterate(ctx context.Context, where sq.Sqlizer) iter.Seq2[T, error] {
+	selectBuilder := repo.SelectBuilder
+	if where != nil {
+		selectBuilder = selectBuilder.Where(where)
+	}
+	return repo.IterateBuilder(ctx, selectBuilder)
+}
+
+func (repo Repository[T]) IterateBuilder(ctx context.Context, selectBuilder sq.SelectBuilder) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		rows, err := repo.queryRows(ctx, "Iterate", selectBuilder)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			obj, ok, err := repo.convertRow(rows)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if ok && !yield(obj, nil) {
+				return
+			}
+		}
+		if err = rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+func (repo Repository[T]) queryRows(ctx context.Context, name string, selectBuilder sq.SelectBuilder) (pgx.Rows, error) {
+	query, args, err := selectBuilder.PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	return repo.DB.QueryContext(ctx, pg_api.Query{Name: name, QueryRaw: query}, args...)
+}
+
+// convertRow runs Converter turning its panic into an error, ok is false when Converter skipped the row
+func (repo Repository[T]) convertRow(row pgx.Row) (obj T, ok bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, isErr := r.(error); isErr {
+				err = errors.Wrap(e, "can't convert row")
+			} else {
+				err = errors.Errorf("can't convert row: %v", r)
+			}
+		}
+	}()
+	converted := repo.Converter(row)
+	if converted == nil {
+		return obj, false, nil
+	}
+	if t, isPtr := converted.(*T); isPtr {
+		if t == nil {
+			return obj, false, nil
+		}
+		return *t, true, nil
+	}
+	return converted.(T), true, nil
+}
@@ -0,0 +1,102 @@
+package pg
+
+import (
+	"context"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"strings"
+)
+
+// LockOption is a row locking clause, one lock strength optionally followed by SkipLocked or NoWait
+type LockOption string
+
+// Lock strengths
+const (
+	ForUpdate      LockOption = "FOR UPDATE"
+	ForNoKeyUpdate LockOption = "FOR NO KEY UPDATE"
+	ForShare       LockOption = "FOR SHARE"
+	ForKeyShare    LockOption = "FOR KEY SHARE"
+)
+
+// Lock wait policies
+const (
+	SkipLocked LockOption = "SKIP LOCKED"
+	NoWait     LockOption = "NOWAIT"
+)
+
+const lockNotAvailable = "55P03"
+
+// ErrNoTransaction is returned by row and transaction level locks outside of a transaction
+var ErrNoTransaction = transaction.ErrNoTransaction
+
+// LockNotAvailableError is returned when a NoWait lock finds the row already locked
+type LockNotAvailableError struct {
+	Err *pgconn.PgError
+}
+
+func (e *LockNotAvailableError) Error() string {
+	return "lock not available: " + e.Err.Message
+}
+
+func (e *LockNotAvailableError) Unwrap() error {
+	return e.Err
+}
+
+// GetForUpdate reads the entity by id locking its row until the end of the transaction from TxKey.
+// By default it waits for concurrent locks, pass NoWait or SkipLocked to change it.
+func (repo Repository[T]) GetForUpdate(ctx context.Context, id int64, wait ...LockOption) (T, error) {
+	var zero T
+	objs, err := repo.getLocked(ctx, repo.SelectBuilder.Where(sq.Eq{idColumn: id}), append([]LockOption{ForUpdate}, wait...))
+	if err != nil {
+		return zero, err
+	}
+	if len(objs) == 0 {
+		return zero, pgx.ErrNoRows
+	}
+	return objs[0], nil
+}
+
+func (repo Repository[T]) getLocked(ctx context.Context, selectBuilder sq.SelectBuilder, locks []LockOption) ([]T, error) {
+	if _, ok := ctx.Value(pg_api.TxKey).(pgx.Tx); !ok {
+		return nil, ErrNoTransaction
+	}
+	clause, err := lockClause(locks)
+	if err != nil {
+		return nil, err
+	}
+
+	var objs []T
+	for obj, err := range repo.IterateBuilder(ctx, selectBuilder.Suffix(clause)) {
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == lockNotAvailable {
+				return nil, &LockNotAvailableError{Err: pgErr}
+			}
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+	return repo.loadRelationsForCollection(ctx, objs), nil
+}
+
+func lockClause(locks []LockOption) (string, error) {
+	var strength, wait []string
+	for _, lock := range locks {
+		switch lock {
+		case ForUpdate, ForNoKeyUpdate, ForShare, ForKeyShare:
+			strength = append(strength, string(lock))
+		case SkipLocked, NoWait:
+			wait = append(wait, string(lock))
+		default:
+			return "", errors.Errorf("unknown lock option %q", lock)
+		}
+	}
+	if len(strength) != 1 || len(wait) > 1 {
+		return "", errors.Errorf("invalid lock options %v: need one lock strength and at most one wait policy", locks)
+	}
+	return strings.Join(append(strength, wait...), " "), nil
+}
@@ -0,0 +1,92 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"time"
+)
+
+// Schema keeps a key until Purge finds it expired
+const Schema = `CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key        TEXT PRIMARY KEY,
+    result     JSONB       NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_idx ON idempotency_keys (expires_at)`
+
+// ErrInFlight is returned when another transaction is running fn for the same key
+var ErrInFlight = errors.New("idempotency key is in flight")
+
+func Migrate(ctx context.Context, db pg.DbClient) error {
+	_, err := db.ExecContext(ctx, pg_api.Query{Name: "idempotency.Migrate", QueryRaw: Schema})
+	return err
+}
+
+// Run calls fn once per key within ttl and stores its result as JSON in the same transaction, a replay
+// returns the stored result without calling fn. The key of a failed fn is not stored, so it may be retried.
+// Use a request header for POST endpoints or the message id for inbox deduplication of consumers.
+// Inside a transaction the key commits together with it, otherwise Run opens its own.
+func Run[T any](ctx context.Context, db pg.DbClient, key string, ttl time.Duration, fn func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := db.RunTransaction(ctx, transaction.TxOptions{}, func(ctx context.Context) error {
+		// replays read the committed result without locks, so they don't collide with each other
+		var stored []byte
+		err := db.QueryRowContext(ctx, pg_api.Query{Name: "idempotency.Replay", QueryRaw: `SELECT result FROM idempotency_keys
+             WHERE key = $1 AND expires_at > now()`}, key).Scan(&stored)
+		switch {
+		case err == nil:
+			return errors.Wrapf(json.Unmarshal(stored, &result), "can't decode stored result of %q", key)
+		case !errors.Is(err, pgx.ErrNoRows):
+			return err
+		}
+
+		// the advisory lock covers a key not inserted yet, the row lock a stored one being refreshed
+		ok, err := db.TryXactAdvisoryLock(ctx, pg.AdvisoryKey("idempotency:"+key))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInFlight
+		}
+
+		err = db.QueryRowContext(ctx, pg_api.Query{Name: "idempotency.Get", QueryRaw: `SELECT result FROM idempotency_keys
+             WHERE key = $1 AND expires_at > now() FOR UPDATE NOWAIT`}, key).Scan(&stored)
+		var pgErr *pgconn.PgError
+		switch {
+		case err == nil:
+			return errors.Wrapf(json.Unmarshal(stored, &result), "can't decode stored result of %q", key)
+		case errors.As(err, &pgErr) && pgErr.Code == "55P03":
+			return ErrInFlight
+		case !errors.Is(err, pgx.ErrNoRows):
+			return err
+		}
+
+		if result, err = fn(ctx); err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return errors.Wrapf(err, "can't encode result of %q", key)
+		}
+		_, err = db.ExecContext(ctx, pg_api.Query{Name: "idempotency.Store", QueryRaw: `INSERT INTO idempotency_keys (key, result, expires_at)
+             VALUES ($1, $2, now() + make_interval(secs => $3))
+             ON CONFLICT (key) DO UPDATE SET result = excluded.result, created_at = now(), expires_at = excluded.expires_at`},
+			key, encoded, ttl.Seconds())
+		return err
+	})
+	return result, err
+}
+
+// Purge deletes expired keys
+func Purge(ctx context.Context, db pg.DbClient) (int64, error) {
+	tag, err := db.ExecContext(ctx, pg_api.Query{Name: "idempotency.Purge",
+		QueryRaw: "DELETE FROM idempotency_keys WHERE expires_at <= now()"})
+	return tag.RowsAffected(), err
+}
@@ -0,0 +1,158 @@
+package leader
+
+import (
+	"context"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/logger"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultRetryInterval = 5 * time.Second
+	DefaultCheckInterval = 5 * time.Second
+)
+
+type Options struct {
+	// RetryInterval is the pause between attempts to become the leader
+	RetryInterval time.Duration
+	// CheckInterval is how often the leader verifies the connection holding its lock is alive
+	CheckInterval time.Duration
+}
+
+// Elector makes one of the replicas sharing a name the leader by holding a session advisory lock
+// on a dedicated connection. Leadership is lost with that connection and taken over by another replica.
+type Elector struct {
+	db      pg.DbClient
+	name    string
+	key     int64
+	opts    Options
+	leader  atomic.Bool
+	changes chan bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+	mu      sync.Mutex
+	stopped bool
+}
+
+func New(db pg.DbClient, name string, opts Options) *Elector {
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultRetryInterval
+	}
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = DefaultCheckInterval
+	}
+	return &Elector{
+		db:      db,
+		name:    name,
+		key:     pg.AdvisoryKey("leader:" + name),
+		opts:    opts,
+		changes: make(chan bool, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start runs the election in the background until ctx is done or Close is called,
+// it does nothing once the elector is started or closed
+func (e *Elector) Start(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopped || e.cancel != nil {
+		return
+	}
+	ctx, e.cancel = context.WithCancel(ctx)
+	go e.run(ctx)
+}
+
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Changes reports leadership changes, a slow reader gets the latest state only.
+// It is closed once the elector stops.
+func (e *Elector) Changes() <-chan bool {
+	return e.changes
+}
+
+// Close gives up leadership and stops the election
+func (e *Elector) Close() error {
+	e.mu.Lock()
+	if !e.stopped {
+		e.stopped = true
+		if e.cancel == nil {
+			close(e.changes)
+			close(e.done)
+		} else {
+			e.cancel()
+		}
+	}
+	e.mu.Unlock()
+	<-e.done
+	return nil
+}
+
+func (e *Elector) run(ctx context.Context) {
+	defer close(e.done)
+	defer close(e.changes)
+
+	for {
+		lock, ok, err := e.db.TryAdvisoryLock(ctx, e.key)
+		if err != nil && ctx.Err() == nil {
+			logger.Logger().Warn("leader election failed", slog.String("name", e.name), slog.Any("err", err))
+		}
+		if ok {
+			e.setLeader(true)
+			e.hold(ctx, lock)
+			e.setLeader(false)
+			if err = lock.Release(context.WithoutCancel(ctx)); err != nil {
+				logger.Logger().Warn("leader lock release failed", slog.String("name", e.name), slog.Any("err", err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.opts.RetryInterval):
+		}
+	}
+}
+
+// hold keeps leadership until ctx is done or the lock connection breaks
+func (e *Elector) hold(ctx context.Context, lock *pg.AdvisoryLock) {
+	ticker := time.NewTicker(e.opts.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := lock.Conn().Ping(ctx); err != nil {
+				if ctx.Err() == nil {
+					logger.Logger().Warn("leader connection lost", slog.String("name", e.name), slog.Any("err", err))
+				}
+				return
+			}
+		}
+	}
+}
+
+func (e *Elector) setLeader(leader bool) {
+	if e.leader.Swap(leader) == leader {
+		return
+	}
+	logger.Logger().Info("leadership changed", slog.String("name", e.name), slog.Bool("leader", leader))
+	for {
+		select {
+		case e.changes <- leader:
+			return
+		default:
+			// replace the state nobody read yet
+			select {
+			case <-e.changes:
+			default:
+			}
+		}
+	}
+}
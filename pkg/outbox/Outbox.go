@@ -0,0 +1,76 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"time"
+)
+
+// Channel is notified on commit of a transaction that added messages
+const Channel = "outbox"
+
+// Schema indexes unsent messages only, sent ones wait for Cleanup
+const Schema = `CREATE TABLE IF NOT EXISTS outbox_messages (
+    id         BIGSERIAL PRIMARY KEY,
+    topic      TEXT        NOT NULL,
+    key        TEXT        NOT NULL,
+    payload    JSONB       NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    sent_at    TIMESTAMPTZ,
+    -- failed publishing of the oldest unsent message backs off its whole key
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS outbox_messages_unsent_idx ON outbox_messages (id) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_messages_unsent_key_idx ON outbox_messages (key, id) WHERE sent_at IS NULL`
+
+func Migrate(ctx context.Context, db pg.DbClient) error {
+	_, err := db.ExecContext(ctx, pg_api.Query{Name: "outbox.Migrate", QueryRaw: Schema})
+	return err
+}
+
+type Message struct {
+	ID        int64
+	Topic     string
+	Key       string // messages with the same key are published in the order they were added
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// Add stores a message with payload encoded as JSON in the transaction from TxKey, so it is relayed only
+// if the business writes of that transaction commit. It returns ErrNoTransaction outside of a transaction.
+func Add(ctx context.Context, topic string, key string, payload any) (int64, error) {
+	tx, ok := ctx.Value(transaction.TxKey).(pgx.Tx)
+	if !ok {
+		return 0, transaction.ErrNoTransaction
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't encode outbox payload")
+	}
+
+	var id int64
+	err = tx.QueryRow(ctx, "INSERT INTO outbox_messages (topic, key, payload) VALUES ($1, $2, $3) RETURNING id",
+		topic, key, encoded).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't add outbox message")
+	}
+	// notifications are delivered at commit and folded when repeated in a transaction
+	if _, err = tx.Exec(ctx, "SELECT pg_notify($1, '')", Channel); err != nil {
+		return 0, errors.Wrap(err, "can't notify outbox relay")
+	}
+	return id, nil
+}
+
+// Cleanup deletes messages sent more than olderThan ago
+func Cleanup(ctx context.Context, db pg.DbClient, olderThan time.Duration) (int64, error) {
+	tag, err := db.ExecContext(ctx, pg_api.Query{Name: "outbox.Cleanup",
+		QueryRaw: "DELETE FROM outbox_messages WHERE sent_at < now() - make_interval(secs => $1)"},
+		olderThan.Seconds())
+	return tag.RowsAffected(), err
+}
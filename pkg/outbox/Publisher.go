@@ -0,0 +1,39 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+)
+
+// Publisher delivers messages to a broker. A message may be published again when the relay fails
+// to mark it sent, so consumers have to tolerate duplicates.
+type Publisher interface {
+	Publish(ctx context.Context, message Message) error
+}
+
+// MemoryPublisher keeps published messages in memory, for tests and local runs
+type MemoryPublisher struct {
+	// Fail, when set, is consulted before each message and its error returned instead of publishing
+	Fail     func(message Message) error
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, message Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Fail != nil {
+		if err := p.Fail(message); err != nil {
+			return err
+		}
+	}
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+// Messages returns the published messages in publishing order
+func (p *MemoryPublisher) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Message(nil), p.messages...)
+}
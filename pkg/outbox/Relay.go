@@ -0,0 +1,223 @@
+package outbox
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/logger"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPollInterval = time.Second
+	DefaultBatchSize    = 100
+	DefaultRetryBackoff = time.Second
+	maxRetryBackoff     = time.Hour
+	cleanupInterval     = time.Minute
+)
+
+type RelayOptions struct {
+	PollInterval time.Duration
+	BatchSize    int
+	// Listen wakes the relay by LISTEN on Channel as soon as messages commit, PollInterval remains the fallback
+	Listen bool
+	// Retention is how long sent messages are kept, the relay deletes older ones. They are kept forever when zero.
+	Retention time.Duration
+	// RetryBackoff is the first pause of a key after a failed message, doubled with every further failure
+	RetryBackoff time.Duration
+}
+
+// Relay publishes unsent messages in id order. Relays of all replicas may run, a transaction level
+// advisory lock lets only one of them publish at a time, which keeps the per key order.
+type Relay struct {
+	db        pg.DbClient
+	publisher Publisher
+	opts      RelayOptions
+	lockKey   int64
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	closed    bool
+}
+
+func NewRelay(db pg.DbClient, publisher Publisher, opts RelayOptions) *Relay {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = DefaultRetryBackoff
+	}
+	return &Relay{db: db, publisher: publisher, opts: opts, lockKey: pg.AdvisoryKey("outbox.relay")}
+}
+
+// RelayOnce publishes one batch and marks it sent, it returns the number of messages published.
+// A failed message holds back the later messages with its key until it is published, the key
+// is skipped for a growing backoff meanwhile so that it can't take the batches of the others.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	published := 0
+	err := r.db.RunTransaction(ctx, transaction.TxOptions{}, func(ctx context.Context) error {
+		published = 0
+		ok, err := r.db.TryXactAdvisoryLock(ctx, r.lockKey)
+		if err != nil || !ok {
+			return err
+		}
+
+		rows, err := r.db.QueryContext(ctx, pg_api.Query{Name: "outbox.Unsent", QueryRaw: `SELECT id, topic, key, payload, created_at
+             FROM outbox_messages m
+             WHERE sent_at IS NULL AND NOT EXISTS (
+                 SELECT 1 FROM outbox_messages b
+                 WHERE b.key = m.key AND b.sent_at IS NULL AND b.id <= m.id AND b.next_attempt_at > now())
+             ORDER BY id LIMIT $1`}, r.opts.BatchSize)
+		if err != nil {
+			return err
+		}
+		messages, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Message, error) {
+			var m Message
+			err := row.Scan(&m.ID, &m.Topic, &m.Key, &m.Payload, &m.CreatedAt)
+			return m, err
+		})
+		if err != nil {
+			return err
+		}
+
+		blocked := map[string]bool{}
+		sent := make([]int64, 0, len(messages))
+		for _, message := range messages {
+			if blocked[message.Key] {
+				continue
+			}
+			if err := r.publisher.Publish(ctx, message); err != nil {
+				logger.Logger().Error("can't publish outbox message", slog.Int64("id", message.ID),
+					slog.String("topic", message.Topic), slog.Any("err", err))
+				blocked[message.Key] = true
+				if err := r.backOff(ctx, message.ID); err != nil {
+					return err
+				}
+				continue
+			}
+			sent = append(sent, message.ID)
+		}
+		if len(sent) == 0 {
+			return nil
+		}
+		_, err = r.db.ExecContext(ctx, pg_api.Query{Name: "outbox.Sent",
+			QueryRaw: "UPDATE outbox_messages SET sent_at = now() WHERE id = ANY($1)"}, sent)
+		published = len(sent)
+		return err
+	})
+	return published, err
+}
+
+// backOff postpones the key of the failed message
+func (r *Relay) backOff(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, pg_api.Query{Name: "outbox.BackOff", QueryRaw: `UPDATE outbox_messages
+         SET attempts = attempts + 1,
+             next_attempt_at = now() + make_interval(secs => least($2 * power(2, attempts), $3))
+         WHERE id = $1`}, id, r.opts.RetryBackoff.Seconds(), maxRetryBackoff.Seconds())
+	return err
+}
+
+// Start relays in the background until Close or the end of ctx,
+// it does nothing once the relay is started or closed
+func (r *Relay) Start(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.cancel != nil {
+		return
+	}
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.wg.Add(1)
+	go r.run(ctx)
+}
+
+// Close waits for the batch in flight
+func (r *Relay) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+	return nil
+}
+
+func (r *Relay) run(ctx context.Context) {
+	defer r.wg.Done()
+	var listener *pgxpool.Conn
+	defer func() {
+		if listener != nil {
+			unlisten(context.WithoutCancel(ctx), listener)
+		}
+	}()
+
+	var cleaned time.Time
+	for ctx.Err() == nil {
+		published, err := r.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Logger().Error("outbox relay failed", slog.Any("err", err))
+		}
+		if r.opts.Retention > 0 && time.Since(cleaned) > cleanupInterval {
+			if _, err := Cleanup(ctx, r.db, r.opts.Retention); err != nil && ctx.Err() == nil {
+				logger.Logger().Error("outbox cleanup failed", slog.Any("err", err))
+			}
+			cleaned = time.Now()
+		}
+		if published == r.opts.BatchSize {
+			continue
+		}
+
+		if r.opts.Listen && listener == nil {
+			listener = r.listen(ctx)
+		}
+		if listener == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(r.opts.PollInterval):
+			}
+			continue
+		}
+		waitCtx, cancel := context.WithTimeout(ctx, r.opts.PollInterval)
+		_, err = listener.Conn().WaitForNotification(waitCtx)
+		cancel()
+		if err != nil && waitCtx.Err() == nil {
+			// the connection is broken, it is replaced on the next round
+			logger.Logger().Warn("outbox listener failed", slog.Any("err", err))
+			listener.Conn().Close(context.WithoutCancel(ctx))
+			listener.Release()
+			listener = nil
+		}
+	}
+}
+
+// listen pins a connection subscribed to Channel, nil when it fails and the relay keeps polling
+func (r *Relay) listen(ctx context.Context) *pgxpool.Conn {
+	conn, err := r.db.Acquire(ctx)
+	if err != nil {
+		logger.Logger().Warn("can't acquire outbox listener", slog.Any("err", err))
+		return nil
+	}
+	if _, err = conn.Exec(ctx, "LISTEN "+Channel); err != nil {
+		logger.Logger().Warn("can't listen for outbox messages", slog.Any("err", err))
+		conn.Release()
+		return nil
+	}
+	return conn
+}
+
+// unlisten hands the listener back to the pool without its subscription, a connection which can't
+// unsubscribe is closed so that no later user collects the notifications
+func unlisten(ctx context.Context, conn *pgxpool.Conn) {
+	if _, err := conn.Exec(ctx, "UNLISTEN *"); err != nil {
+		_ = conn.Conn().Close(ctx)
+	}
+	conn.Release()
+}
@@ -0,0 +1,203 @@
+package queue
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/logger"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPollInterval = time.Second
+	DefaultLease        = 5 * time.Minute
+)
+
+// Handler processes a job, a returned error or panic schedules a retry
+type Handler func(ctx context.Context, job Job) error
+
+type Config struct {
+	Queue        string // DefaultQueue when empty
+	Concurrency  int    // number of workers, 1 when zero
+	PollInterval time.Duration
+	// Lease is how long a claimed job stays reserved, jobs of crashed workers are claimed again after it.
+	// It has to exceed the longest handler run.
+	Lease time.Duration
+	// Backoff is the delay before the given failed attempt is retried, exponential with jitter when nil
+	Backoff  func(attempt int) time.Duration
+	Handlers map[string]Handler // by job kind, other kinds are left for other pools
+}
+
+// Pool claims jobs with FOR UPDATE SKIP LOCKED, so any number of pools may share the table
+type Pool struct {
+	db     pg.DbClient
+	cfg    Config
+	kinds  []string
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	closed bool
+}
+
+func NewPool(db pg.DbClient, cfg Config) *Pool {
+	if cfg.Queue == "" {
+		cfg.Queue = DefaultQueue
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = DefaultLease
+	}
+	if cfg.Backoff == nil {
+		cfg.Backoff = defaultBackoff
+	}
+	kinds := make([]string, 0, len(cfg.Handlers))
+	for kind := range cfg.Handlers {
+		kinds = append(kinds, kind)
+	}
+	return &Pool{db: db, cfg: cfg, kinds: kinds}
+}
+
+// Start launches the workers. Handlers run with ctx, canceling it aborts them, while Close lets them finish.
+// It does nothing once the pool is started or closed.
+func (p *Pool) Start(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.cancel != nil {
+		return
+	}
+	claimCtx, cancel := context.WithCancel(ctx)
+	p.cancel = cancel
+	for i := 0; i < p.cfg.Concurrency; i++ {
+		p.wg.Add(1)
+		go p.work(claimCtx, ctx)
+	}
+}
+
+// Close stops claiming and waits for running handlers
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+	return nil
+}
+
+func (p *Pool) work(claimCtx context.Context, handlerCtx context.Context) {
+	defer p.wg.Done()
+	for {
+		job, dead, err := p.claim(claimCtx)
+		if err != nil && claimCtx.Err() == nil {
+			logger.Logger().Error("can't claim job", slog.String("queue", p.cfg.Queue), slog.Any("err", err))
+		}
+		if dead {
+			continue
+		}
+		if job != nil {
+			p.finish(handlerCtx, *job, p.run(handlerCtx, *job))
+			continue
+		}
+
+		select {
+		case <-claimCtx.Done():
+			return
+		case <-time.After(p.cfg.PollInterval):
+		}
+	}
+}
+
+// claim reserves the next due job for Lease, nil when there is none. A job whose lease expired
+// on its last attempt is dead lettered instead, dead is true then.
+func (p *Pool) claim(ctx context.Context) (job *Job, dead bool, err error) {
+	job = &Job{}
+	var state string
+	err = p.db.QueryRowContext(ctx, pg_api.Query{Name: "queue.Claim", QueryRaw: `UPDATE queue_jobs
+         SET state        = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'running' END,
+             attempts     = CASE WHEN attempts >= max_attempts THEN attempts ELSE attempts + 1 END,
+             locked_until = CASE WHEN attempts >= max_attempts THEN NULL ELSE now() + make_interval(secs => $3) END,
+             last_error   = CASE WHEN attempts >= max_attempts THEN 'lease expired on the last attempt' ELSE last_error END,
+             finished_at  = CASE WHEN attempts >= max_attempts THEN now() END
+         WHERE id = (
+             SELECT id FROM queue_jobs
+             WHERE queue = $1 AND kind = ANY($2)
+               AND ((state = 'pending' AND run_at <= now()) OR (state = 'running' AND locked_until < now()))
+             ORDER BY priority DESC, run_at, id
+             LIMIT 1
+             FOR UPDATE SKIP LOCKED)
+         RETURNING id, queue, kind, payload, priority, attempts, max_attempts, state`},
+		p.cfg.Queue, p.kinds, p.cfg.Lease.Seconds()).
+		Scan(&job.ID, &job.Queue, &job.Kind, &job.Payload, &job.Priority, &job.Attempts, &job.MaxAttempts, &state)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if state == StateDead {
+		logger.Logger().Error("job is dead, lease expired on the last attempt", slog.Int64("id", job.ID), slog.String("kind", job.Kind))
+		return job, true, nil
+	}
+	return job, false, nil
+}
+
+func (p *Pool) run(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = transaction.NewPanicError(r)
+		}
+	}()
+	return p.cfg.Handlers[job.Kind](ctx, job)
+}
+
+// finish records the outcome, a failed job is retried after Backoff or becomes dead when out of attempts.
+// The updates match only the claim of this run, a job reclaimed after its lease expired belongs to the new run.
+func (p *Pool) finish(ctx context.Context, job Job, jobErr error) {
+	ctx = context.WithoutCancel(ctx)
+	var tag pgconn.CommandTag
+	var err error
+	switch {
+	case jobErr == nil:
+		tag, err = p.db.ExecContext(ctx, pg_api.Query{Name: "queue.Done", QueryRaw: `UPDATE queue_jobs
+             SET state = 'done', locked_until = NULL, last_error = NULL, finished_at = now()
+             WHERE id = $1 AND state = 'running' AND attempts = $2`}, job.ID, job.Attempts)
+	case job.Attempts >= job.MaxAttempts:
+		logger.Logger().Error("job is dead", slog.Int64("id", job.ID), slog.String("kind", job.Kind), slog.Any("err", jobErr))
+		tag, err = p.db.ExecContext(ctx, pg_api.Query{Name: "queue.Dead", QueryRaw: `UPDATE queue_jobs
+             SET state = 'dead', locked_until = NULL, last_error = $3, finished_at = now()
+             WHERE id = $1 AND state = 'running' AND attempts = $2`}, job.ID, job.Attempts, jobErr.Error())
+	default:
+		logger.Logger().Warn("job failed", slog.Int64("id", job.ID), slog.String("kind", job.Kind),
+			slog.Int("attempt", job.Attempts), slog.Any("err", jobErr))
+		tag, err = p.db.ExecContext(ctx, pg_api.Query{Name: "queue.Retry", QueryRaw: `UPDATE queue_jobs
+             SET state = 'pending', locked_until = NULL, last_error = $3, run_at = now() + make_interval(secs => $4)
+             WHERE id = $1 AND state = 'running' AND attempts = $2`},
+			job.ID, job.Attempts, jobErr.Error(), p.cfg.Backoff(job.Attempts).Seconds())
+	}
+	switch {
+	case err != nil:
+		// the lease expires and the job is claimed again
+		logger.Logger().Error("can't record job result", slog.Int64("id", job.ID), slog.Any("err", err))
+	case tag.RowsAffected() == 0:
+		logger.Logger().Warn("job result dropped, the job was reclaimed after its lease expired",
+			slog.Int64("id", job.ID), slog.Int("attempt", job.Attempts))
+	}
+}
+
+func defaultBackoff(attempt int) time.Duration {
+	backoff := time.Second << min(attempt, 12) // about an hour at most
+	return backoff/2 + rand.N(backoff/2+1)
+}
@@ -0,0 +1,99 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"time"
+)
+
+const DefaultQueue = "default"
+
+const DefaultMaxAttempts = 25
+
+// Job states
+const (
+	StatePending = "pending"
+	StateRunning = "running"
+	StateDone    = "done"
+	StateDead    = "dead" // out of attempts, kept for inspection
+)
+
+// Schema of queue_jobs, the partial index serves claims
+const Schema = `CREATE TABLE IF NOT EXISTS queue_jobs (
+    id           BIGSERIAL PRIMARY KEY,
+    queue        TEXT        NOT NULL DEFAULT 'default',
+    kind         TEXT        NOT NULL,
+    payload      JSONB       NOT NULL,
+    priority     INTEGER     NOT NULL DEFAULT 0,
+    state        TEXT        NOT NULL DEFAULT 'pending',
+    attempts     INTEGER     NOT NULL DEFAULT 0,
+    max_attempts INTEGER     NOT NULL DEFAULT 25,
+    run_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    locked_until TIMESTAMPTZ,
+    last_error   TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at  TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS queue_jobs_claim_idx ON queue_jobs (queue, priority DESC, run_at, id)
+    WHERE state IN ('pending', 'running')`
+
+func Migrate(ctx context.Context, db pg.DbClient) error {
+	_, err := db.ExecContext(ctx, pg_api.Query{Name: "queue.Migrate", QueryRaw: Schema})
+	return err
+}
+
+type EnqueueOptions struct {
+	Queue       string    // DefaultQueue when empty
+	Priority    int       // higher runs first
+	RunAt       time.Time // not before, now when zero
+	MaxAttempts int       // DefaultMaxAttempts when zero
+}
+
+type Job struct {
+	ID          int64
+	Queue       string
+	Kind        string
+	Payload     json.RawMessage
+	Priority    int
+	Attempts    int // including the current one
+	MaxAttempts int
+}
+
+// Enqueue stores a job with payload encoded as JSON. Called inside RunTransaction the job becomes
+// visible to workers only if the transaction commits.
+func Enqueue(ctx context.Context, db pg.DbClient, kind string, payload any, opts EnqueueOptions) (int64, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't encode job payload")
+	}
+	if opts.Queue == "" {
+		opts.Queue = DefaultQueue
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	var runAt *time.Time
+	if !opts.RunAt.IsZero() {
+		runAt = &opts.RunAt
+	}
+
+	var id int64
+	err = db.QueryRowContext(ctx, pg_api.Query{Name: "queue.Enqueue", QueryRaw: `INSERT INTO queue_jobs (queue, kind, payload, priority, max_attempts, run_at)
+         VALUES ($1, $2, $3, $4, $5, coalesce($6, now())) RETURNING id`},
+		opts.Queue, kind, encoded, opts.Priority, opts.MaxAttempts, runAt).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't enqueue job")
+	}
+	return id, nil
+}
+
+// Cleanup deletes done jobs finished more than olderThan ago, dead ones are kept
+func Cleanup(ctx context.Context, db pg.DbClient, olderThan time.Duration) (int64, error) {
+	tag, err := db.ExecContext(ctx, pg_api.Query{Name: "queue.Cleanup",
+		QueryRaw: "DELETE FROM queue_jobs WHERE state = 'done' AND finished_at < now() - make_interval(secs => $1)"},
+		olderThan.Seconds())
+	return tag.RowsAffected(), err
+}
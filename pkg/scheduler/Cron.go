@@ -0,0 +1,145 @@
+package scheduler
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed five field cron expression: minute hour day-of-month month day-of-week
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// with both day fields restricted a day matches either of them, as in cron(8)
+	domAny, dowAny bool
+}
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+
+var dayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// ParseCron accepts lists, ranges, steps, month and day names and the @hourly style macros
+func ParseCron(spec string) (Cron, error) {
+	if macro, ok := macros[strings.ToLower(strings.TrimSpace(spec))]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return Cron{}, errors.Errorf("cron %q: expected 5 fields, got %d", spec, len(fields))
+	}
+
+	var cron Cron
+	var err error
+	if cron.minute, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return Cron{}, errors.Wrapf(err, "cron %q: minute", spec)
+	}
+	if cron.hour, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return Cron{}, errors.Wrapf(err, "cron %q: hour", spec)
+	}
+	if cron.dom, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return Cron{}, errors.Wrapf(err, "cron %q: day of month", spec)
+	}
+	if cron.month, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return Cron{}, errors.Wrapf(err, "cron %q: month", spec)
+	}
+	if cron.dow, err = parseField(fields[4], 0, 7, dayNames); err != nil {
+		return Cron{}, errors.Wrapf(err, "cron %q: day of week", spec)
+	}
+	if cron.dow&(1<<7) != 0 { // 7 is Sunday as well
+		cron.dow |= 1
+	}
+	cron.domAny = fields[2] == "*" || fields[2] == "?"
+	cron.dowAny = fields[4] == "*" || fields[4] == "?"
+	return cron, nil
+}
+
+func parseField(field string, lo int, hi int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, errors.Errorf("invalid step in %q", part)
+			}
+			rng = part[:i]
+		}
+
+		from, to := lo, hi
+		if rng != "*" && rng != "?" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if from, err = parseValue(bounds[0], names); err != nil {
+				return 0, err
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = parseValue(bounds[1], names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				to = hi // 5/15 means from 5 to the end by 15
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, errors.Errorf("%q is out of range %d-%d", part, lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(value string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(value)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Errorf("invalid value %q", value)
+	}
+	return v, nil
+}
+
+// Next returns the first matching minute strictly after t in the location of t, zero when there is none
+// within five years (e.g. February 30th)
+func (c Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
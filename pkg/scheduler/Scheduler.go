@@ -0,0 +1,252 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/logger"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPollInterval     = time.Second
+	DefaultMisfireThreshold = time.Minute
+)
+
+// Schema keeps one row per schedule and one per fired slot
+const Schema = `CREATE TABLE IF NOT EXISTS scheduler_schedules (
+    name        TEXT PRIMARY KEY,
+    spec        TEXT        NOT NULL,
+    next_run_at TIMESTAMPTZ NOT NULL,
+    last_run_at TIMESTAMPTZ
+);
+CREATE TABLE IF NOT EXISTS scheduler_runs (
+    id           BIGSERIAL PRIMARY KEY,
+    name         TEXT        NOT NULL,
+    scheduled_at TIMESTAMPTZ NOT NULL,
+    started_at   TIMESTAMPTZ NOT NULL,
+    finished_at  TIMESTAMPTZ,
+    duration_ms  BIGINT,
+    error        TEXT,
+    UNIQUE (name, scheduled_at)
+)`
+
+func Migrate(ctx context.Context, db pg.DbClient) error {
+	_, err := db.ExecContext(ctx, pg_api.Query{Name: "scheduler.Migrate", QueryRaw: Schema})
+	return err
+}
+
+// CatchUp decides what happens to the slots missed while no replica was running
+type CatchUp string
+
+const (
+	CatchUpOnce CatchUp = "once" // missed slots collapse into one run, the default
+	CatchUpAll  CatchUp = "all"  // every missed slot runs, oldest first
+	CatchUpSkip CatchUp = "skip" // slots older than MisfireThreshold are dropped
+)
+
+// Job is called with the slot it runs for
+type Job func(ctx context.Context, scheduledAt time.Time) error
+
+type Options struct {
+	PollInterval     time.Duration
+	MisfireThreshold time.Duration  // used by CatchUpSkip
+	Location         *time.Location // cron specs are evaluated in it, UTC when nil
+}
+
+type schedule struct {
+	name    string
+	spec    string
+	cron    Cron
+	catchUp CatchUp
+	job     Job
+}
+
+// Scheduler fires every slot of a schedule once across all replicas sharing the database: the schedule row
+// is claimed with FOR UPDATE SKIP LOCKED and its next_run_at advanced in the same transaction.
+// A replica crashing during a run leaves the run without finished_at, the slot is not retried.
+type Scheduler struct {
+	db        pg.DbClient
+	opts      Options
+	schedules []schedule
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	closed    bool
+}
+
+func New(db pg.DbClient, opts Options) *Scheduler {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.MisfireThreshold <= 0 {
+		opts.MisfireThreshold = DefaultMisfireThreshold
+	}
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	return &Scheduler{db: db, opts: opts}
+}
+
+// Register adds a schedule, it must be called before Start
+func (s *Scheduler) Register(name string, spec string, catchUp CatchUp, job Job) error {
+	cron, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+	if catchUp == "" {
+		catchUp = CatchUpOnce
+	}
+	for _, registered := range s.schedules {
+		if registered.name == name {
+			return errors.Errorf("schedule %q is already registered", name)
+		}
+	}
+	s.schedules = append(s.schedules, schedule{name: name, spec: spec, cron: cron, catchUp: catchUp, job: job})
+	return nil
+}
+
+// Start stores the registered schedules and polls them until Close. A schedule whose spec changed
+// starts over from now, an unchanged one keeps its next run and so catches up on missed slots.
+// It does nothing once the scheduler is started or closed.
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.cancel != nil {
+		return nil
+	}
+	for _, sch := range s.schedules {
+		next := sch.cron.Next(time.Now().In(s.opts.Location))
+		if next.IsZero() {
+			return errors.Errorf("schedule %q never fires", sch.name)
+		}
+		_, err := s.db.ExecContext(ctx, pg_api.Query{Name: "scheduler.Register", QueryRaw: `INSERT INTO scheduler_schedules (name, spec, next_run_at)
+             VALUES ($1, $2, $3)
+             ON CONFLICT (name) DO UPDATE SET spec = excluded.spec, next_run_at = excluded.next_run_at
+             WHERE scheduler_schedules.spec <> excluded.spec`}, sch.name, sch.spec, next)
+		if err != nil {
+			return errors.Wrapf(err, "can't register schedule %q", sch.name)
+		}
+	}
+
+	pollCtx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	for _, sch := range s.schedules {
+		s.wg.Add(1)
+		go s.poll(pollCtx, ctx, sch)
+	}
+	return nil
+}
+
+// Close stops polling and waits for running jobs
+func (s *Scheduler) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Scheduler) poll(pollCtx context.Context, jobCtx context.Context, sch schedule) {
+	defer s.wg.Done()
+	for {
+		fired, err := s.fire(pollCtx, jobCtx, sch)
+		if err != nil && pollCtx.Err() == nil {
+			logger.Logger().Error("can't fire schedule", slog.String("name", sch.name), slog.Any("err", err))
+		}
+		if fired {
+			continue // CatchUpAll may have more slots due
+		}
+		select {
+		case <-pollCtx.Done():
+			return
+		case <-time.After(s.opts.PollInterval):
+		}
+	}
+}
+
+// fire claims the schedule when it is due and runs its job, it reports whether a slot was claimed
+func (s *Scheduler) fire(pollCtx context.Context, jobCtx context.Context, sch schedule) (bool, error) {
+	var runID int64
+	var scheduledAt time.Time
+	claimed := false
+	err := s.db.RunTransaction(pollCtx, transaction.TxOptions{}, func(ctx context.Context) error {
+		var due, now time.Time
+		err := s.db.QueryRowContext(ctx, pg_api.Query{Name: "scheduler.Claim", QueryRaw: `SELECT next_run_at, now() FROM scheduler_schedules
+             WHERE name = $1 AND next_run_at <= now()
+             FOR UPDATE SKIP LOCKED`}, sch.name).Scan(&due, &now)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		claimed = true
+
+		due, now = due.In(s.opts.Location), now.In(s.opts.Location)
+		var next time.Time
+		run := true
+		switch sch.catchUp {
+		case CatchUpAll:
+			scheduledAt, next = due, sch.cron.Next(due)
+		default:
+			// the latest slot that is due stands for all the missed ones
+			scheduledAt = due
+			for slot := sch.cron.Next(due); !slot.IsZero() && !slot.After(now); slot = sch.cron.Next(slot) {
+				scheduledAt = slot
+			}
+			next = sch.cron.Next(now)
+			run = sch.catchUp != CatchUpSkip || now.Sub(scheduledAt) <= s.opts.MisfireThreshold
+		}
+
+		_, err = s.db.ExecContext(ctx, pg_api.Query{Name: "scheduler.Advance",
+			QueryRaw: "UPDATE scheduler_schedules SET next_run_at = $2, last_run_at = coalesce($3, last_run_at) WHERE name = $1"},
+			sch.name, next, runAt(run, scheduledAt))
+		if err != nil || !run {
+			return err
+		}
+		return s.db.QueryRowContext(ctx, pg_api.Query{Name: "scheduler.Run", QueryRaw: `INSERT INTO scheduler_runs (name, scheduled_at, started_at)
+             VALUES ($1, $2, clock_timestamp()) RETURNING id`}, sch.name, scheduledAt).Scan(&runID)
+	})
+	if err != nil || runID == 0 {
+		return claimed && err == nil, err
+	}
+
+	started := time.Now()
+	jobErr := s.run(jobCtx, sch, scheduledAt)
+	var errText *string
+	if jobErr != nil {
+		logger.Logger().Error("scheduled job failed", slog.String("name", sch.name),
+			slog.Time("scheduled_at", scheduledAt), slog.Any("err", jobErr))
+		text := jobErr.Error()
+		errText = &text
+	}
+	_, err = s.db.ExecContext(context.WithoutCancel(jobCtx), pg_api.Query{Name: "scheduler.Finish",
+		QueryRaw: "UPDATE scheduler_runs SET finished_at = clock_timestamp(), duration_ms = $2, error = $3 WHERE id = $1"},
+		runID, time.Since(started).Milliseconds(), errText)
+	return true, err
+}
+
+func (s *Scheduler) run(ctx context.Context, sch schedule, scheduledAt time.Time) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = transaction.NewPanicError(r)
+		}
+	}()
+	return sch.job(ctx, scheduledAt)
+}
+
+func runAt(run bool, scheduledAt time.Time) *time.Time {
+	if !run {
+		return nil
+	}
+	return &scheduledAt
+}
@@ -0,0 +1,57 @@
+package transaction
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// Runner starts transactions, DbClient implements it
+type Runner interface {
+	RunTransaction(ctx context.Context, opts TxOptions, f func(ctx context.Context) error) error
+}
+
+// PanicError is a panic recovered inside a transaction, Stack is where the panic happened
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+// NewPanicError has to be called from the deferred function recovering the panic to capture its stack
+func NewPanicError(value any) *PanicError {
+	return &PanicError{Value: value, Stack: debug.Stack()}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic recovered: %v", e.Value)
+}
+
+// Unwrap exposes a panicked error, so errors.Is and errors.As see repository errors
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Do runs fn in a transaction and returns its result, panics inside fn are returned as *PanicError
+func Do[T any](ctx context.Context, db Runner, opts TxOptions, fn func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := db.RunTransaction(ctx, opts, func(ctx context.Context) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = NewPanicError(r)
+			}
+		}()
+		result, err = fn(ctx)
+		return err
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// DoReadOnly runs fn in a read only transaction
+func DoReadOnly[T any](ctx context.Context, db Runner, fn func(ctx context.Context) (T, error)) (T, error) {
+	return Do(ctx, db, TxOptions{AccessMode: ReadOnly}, fn)
+}
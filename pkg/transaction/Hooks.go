@@ -0,0 +1,107 @@
+package transaction
+
+import (
+	"context"
+	"github.com/simpleGorm/pg/internal/logger"
+	"log/slog"
+	"sync"
+)
+
+const hooksKey contextKey = "tx_hooks"
+
+// Hooks are the callbacks registered for one transaction, transaction managers attach them with WithHooks
+// and run them when the transaction finishes
+type Hooks struct {
+	mu            sync.Mutex
+	afterCommit   []func(ctx context.Context)
+	afterRollback []func(ctx context.Context)
+}
+
+func WithHooks(ctx context.Context) (context.Context, *Hooks) {
+	hooks := &Hooks{}
+	return context.WithValue(ctx, hooksKey, hooks), hooks
+}
+
+// AfterCommit registers fn to run once the outermost transaction from the context commits.
+// Without a transaction the changes are already committed, so fn runs immediately.
+func AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	hooks, ok := ctx.Value(hooksKey).(*Hooks)
+	if !ok {
+		runHook(ctx, fn)
+		return
+	}
+	hooks.mu.Lock()
+	hooks.afterCommit = append(hooks.afterCommit, fn)
+	hooks.mu.Unlock()
+}
+
+// AfterRollback registers fn to run once the work done with the context is rolled back, either with
+// the whole transaction or with the savepoint fn was registered in. Without a transaction nothing
+// can be rolled back, so fn is dropped.
+func AfterRollback(ctx context.Context, fn func(ctx context.Context)) {
+	hooks, ok := ctx.Value(hooksKey).(*Hooks)
+	if !ok {
+		return
+	}
+	hooks.mu.Lock()
+	hooks.afterRollback = append(hooks.afterRollback, fn)
+	hooks.mu.Unlock()
+}
+
+func (h *Hooks) RunAfterCommit(ctx context.Context) {
+	h.mu.Lock()
+	callbacks := h.afterCommit
+	h.afterCommit, h.afterRollback = nil, nil
+	h.mu.Unlock()
+	for _, fn := range callbacks {
+		runHook(ctx, fn)
+	}
+}
+
+func (h *Hooks) RunAfterRollback(ctx context.Context) {
+	h.mu.Lock()
+	callbacks := h.afterRollback
+	h.afterCommit, h.afterRollback = nil, nil
+	h.mu.Unlock()
+	for _, fn := range callbacks {
+		runHook(ctx, fn)
+	}
+}
+
+type hooksMark struct {
+	commit, rollback int
+}
+
+func (h *Hooks) mark() hooksMark {
+	if h == nil {
+		return hooksMark{}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return hooksMark{commit: len(h.afterCommit), rollback: len(h.afterRollback)}
+}
+
+// rollbackTo forgets commit callbacks registered after mark and runs the rollback ones
+func (h *Hooks) rollbackTo(ctx context.Context, mark hooksMark) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	callbacks := h.afterRollback[mark.rollback:]
+	h.afterCommit = h.afterCommit[:mark.commit]
+	h.afterRollback = h.afterRollback[:mark.rollback:mark.rollback]
+	h.mu.Unlock()
+	for _, fn := range callbacks {
+		runHook(ctx, fn)
+	}
+}
+
+// runHook keeps a failing callback from affecting the others and the already finished transaction
+func runHook(ctx context.Context, fn func(ctx context.Context)) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Logger().Error("transaction hook panicked", slog.Any("panic", r))
+		}
+	}()
+	fn(ctx)
+}
@@ -0,0 +1,61 @@
+package transaction
+
+import (
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"math/rand/v2"
+	"time"
+)
+
+// SQLSTATE codes retried by default
+const (
+	SerializationFailure = "40001"
+	DeadlockDetected     = "40P01"
+)
+
+// RetryPolicy re-runs a whole transaction which failed with one of RetryableCodes
+type RetryPolicy struct {
+	MaxAttempts    int // including the first run
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	RetryableCodes []string // SerializationFailure and DeadlockDetected when empty
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     time.Second,
+}
+
+func (p RetryPolicy) Retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	codes := p.RetryableCodes
+	if len(codes) == 0 {
+		codes = []string{SerializationFailure, DeadlockDetected}
+	}
+	for _, code := range codes {
+		if pgErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff is the pause after the given failed attempt, exponential with full jitter
+// so that contending transactions don't retry in lockstep
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return rand.N(backoff + 1)
+}
@@ -0,0 +1,52 @@
+package transaction
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+type contextKey string
+
+// TxKey is the context key the current pgx.Tx is stored under
+const TxKey contextKey = "tx"
+
+var (
+	ErrNoTransaction           = errors.New("no transaction in context")
+	ErrTransactionExists       = errors.New("transaction already in context")
+	ErrIncompatibleTransaction = errors.New("incompatible with the current transaction")
+)
+
+// Savepoint runs fn inside a savepoint of the transaction from the context. When fn fails or panics only
+// its changes are rolled back and the error is returned, the outer transaction stays usable.
+func Savepoint(ctx context.Context, name string, fn func(ctx context.Context) error) (err error) {
+	tx, ok := ctx.Value(TxKey).(pgx.Tx)
+	if !ok {
+		return ErrNoTransaction
+	}
+	savepoint := pgx.Identifier{name}.Sanitize()
+	if _, err = tx.Exec(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return errors.Wrapf(err, "can't create savepoint %s", name)
+	}
+	hooks, _ := ctx.Value(hooksKey).(*Hooks)
+	mark := hooks.mark()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = NewPanicError(r)
+		}
+
+		if err != nil {
+			if _, errRollback := tx.Exec(context.WithoutCancel(ctx), "ROLLBACK TO SAVEPOINT "+savepoint); errRollback != nil {
+				err = errors.Wrapf(err, "rollback to savepoint %s failed: %v", name, errRollback)
+			}
+			hooks.rollbackTo(ctx, mark)
+			return
+		}
+		if _, err = tx.Exec(ctx, "RELEASE SAVEPOINT "+savepoint); err != nil {
+			err = errors.Wrapf(err, "can't release savepoint %s", name)
+		}
+	}()
+
+	return fn(ctx)
+}
@@ -1,5 +1,14 @@
 package transaction
 
+import (
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"sort"
+	"strings"
+	"time"
+)
+
 type TxIsoLevel string
 
 // Transaction isolation levels
@@ -28,9 +37,134 @@ const (
 	NotDeferrable TxDeferrableMode = "not deferrable"
 )
 
+// Propagation defines how a transaction relates to the one already present in the context
+type Propagation string
+
+// Transaction propagation modes
+const (
+	// Nested runs in a savepoint of the current transaction or starts a new one, the default when unset
+	Nested Propagation = "nested"
+	// Required joins the current transaction or starts a new one
+	Required Propagation = "required"
+	// RequiresNew always starts a new transaction on a separate connection
+	RequiresNew Propagation = "requires new"
+	// Mandatory joins the current transaction and fails without one
+	Mandatory Propagation = "mandatory"
+	// Never runs without transaction and fails when there is one
+	Never Propagation = "never"
+	// Supports joins the current transaction or runs without one
+	Supports Propagation = "supports"
+)
+
 // TxOptions are transaction modes within a transaction block
 type TxOptions struct {
 	IsoLevel       TxIsoLevel
 	AccessMode     TxAccessMode
 	DeferrableMode TxDeferrableMode
+	Propagation    Propagation
+	// Retry re-runs the transaction on serialization failures and deadlocks,
+	// it applies only to calls starting a new transaction
+	Retry *RetryPolicy
+
+	// Settings below are applied with SET LOCAL when the transaction starts and are reset by PostgreSQL
+	// when it ends. A nested or joining call applies them in the current transaction and restores the outer
+	// values when it completes, as releasing a savepoint keeps SET LOCAL values.
+	StatementTimeout                time.Duration
+	LockTimeout                     time.Duration
+	IdleInTransactionSessionTimeout time.Duration
+	SearchPath                      []string
+	Role                            string
+	// Settings are any other run-time parameters, custom ones such as app.current_user included
+	Settings map[string]string
+
+	// DeferConstraints are the deferrable constraints checked only at commit, AllConstraints defers all of them.
+	// Violations are then reported by the commit as *ConstraintViolationError. A nested call checks the ones
+	// the outer transaction doesn't defer when it completes and can't defer AllConstraints.
+	DeferConstraints []string
+}
+
+// AllConstraints in TxOptions.DeferConstraints defers every deferrable constraint
+const AllConstraints = "ALL"
+
+// ConstraintViolationError is a deferred constraint found violated at commit
+type ConstraintViolationError struct {
+	Constraint string
+	Table      string
+	Code       string // SQLSTATE, for example 23503 for foreign keys
+	Err        *pgconn.PgError
+}
+
+func (e *ConstraintViolationError) Error() string {
+	return fmt.Sprintf("constraint %s on %s violated: %s", e.Constraint, e.Table, e.Err.Message)
+}
+
+func (e *ConstraintViolationError) Unwrap() error {
+	return e.Err
+}
+
+// SetConstraintsStatement returns the SET CONSTRAINTS statement for DeferConstraints, empty when there is none
+func (o TxOptions) SetConstraintsStatement() string {
+	return setConstraintsStatement(o.DeferConstraints, "DEFERRED")
+}
+
+// ImmediateConstraintsStatement returns the SET CONSTRAINTS statement checking the constraints again
+// at the end of each statement, empty when there is none
+func ImmediateConstraintsStatement(constraints []string) string {
+	return setConstraintsStatement(constraints, "IMMEDIATE")
+}
+
+func setConstraintsStatement(constraints []string, mode string) string {
+	if len(constraints) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(constraints))
+	for _, name := range constraints {
+		if name == AllConstraints {
+			return "SET CONSTRAINTS ALL " + mode
+		}
+		names = append(names, pgx.Identifier(strings.Split(name, ".")).Sanitize())
+	}
+	return "SET CONSTRAINTS " + strings.Join(names, ", ") + " " + mode
+}
+
+// Setting is one run-time parameter
+type Setting struct {
+	Name  string
+	Value string
+}
+
+// LocalSettings lists the settings of the options, custom ones ordered by name
+func (o TxOptions) LocalSettings() []Setting {
+	var settings []Setting
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"statement_timeout", o.StatementTimeout},
+		{"lock_timeout", o.LockTimeout},
+		{"idle_in_transaction_session_timeout", o.IdleInTransactionSessionTimeout},
+	} {
+		if timeout.value > 0 {
+			settings = append(settings, Setting{Name: timeout.name, Value: fmt.Sprintf("%dms", timeout.value.Milliseconds())})
+		}
+	}
+	if len(o.SearchPath) > 0 {
+		schemas := make([]string, len(o.SearchPath))
+		for i, schema := range o.SearchPath {
+			schemas[i] = pgx.Identifier{schema}.Sanitize()
+		}
+		settings = append(settings, Setting{Name: "search_path", Value: strings.Join(schemas, ", ")})
+	}
+	if o.Role != "" {
+		settings = append(settings, Setting{Name: "role", Value: o.Role})
+	}
+	names := make([]string, 0, len(o.Settings))
+	for name := range o.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		settings = append(settings, Setting{Name: name, Value: o.Settings[name]})
+	}
+	return settings
 }
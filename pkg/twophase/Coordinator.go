@@ -0,0 +1,296 @@
+package twophase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/simpleGorm/pg"
+	"github.com/simpleGorm/pg/internal/logger"
+	"github.com/simpleGorm/pg/internal/pg_api"
+	"github.com/simpleGorm/pg/pkg/transaction"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Schema of the decision log kept in the database of the first participant. A row means the transaction
+// was decided to commit, recovery commits prepared transactions with a row and rolls back the others.
+// Participants need max_prepared_transactions above zero.
+const Schema = `CREATE TABLE IF NOT EXISTS twophase_decisions (
+    gid        TEXT PRIMARY KEY,
+    decided_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// ErrInDoubt is returned when the commit decision was made but not every participant confirmed it,
+// Recover finishes such transactions
+var ErrInDoubt = errors.New("two-phase commit in doubt")
+
+type Participant struct {
+	Name string
+	DB   pg.DbClient
+}
+
+// Coordinator runs one transaction over several databases with PREPARE TRANSACTION and COMMIT PREPARED
+type Coordinator struct {
+	prefix       string
+	participants []Participant
+}
+
+// NewCoordinator creates a coordinator, prefix starts the global ids of its transactions and has to be
+// unique per coordinator sharing the databases
+func NewCoordinator(prefix string, participants ...Participant) *Coordinator {
+	return &Coordinator{prefix: prefix, participants: participants}
+}
+
+// Migrate creates the decision log
+func (c *Coordinator) Migrate(ctx context.Context) error {
+	_, err := c.log().ExecContext(ctx, pg_api.Query{Name: "twophase.Migrate", QueryRaw: Schema})
+	return err
+}
+
+func (c *Coordinator) log() pg.DbClient {
+	return c.participants[0].DB
+}
+
+// Scope holds the transaction context of every participant
+type Scope struct {
+	contexts map[string]context.Context
+}
+
+// Context returns the context to use with repositories of the named participant,
+// repositories pick the transaction from the context whatever database they were created for
+func (s Scope) Context(name string) context.Context {
+	ctx, ok := s.contexts[name]
+	if !ok {
+		panic(fmt.Sprintf("unknown two-phase participant %q", name))
+	}
+	return ctx
+}
+
+type branch struct {
+	participant Participant
+	tx          pgx.Tx
+	prepared    bool
+}
+
+// Run opens a transaction on every participant, runs fn and commits all of them or none. The settings and
+// deferred constraints of opts apply to every branch. It can't run inside a transaction from ctx, the commit
+// of that one would not be coordinated with the branches.
+func (c *Coordinator) Run(ctx context.Context, opts transaction.TxOptions, fn func(scope Scope) error) (err error) {
+	if _, inTx := ctx.Value(pg_api.TxKey).(pgx.Tx); inTx {
+		return errors.Wrap(transaction.ErrTransactionExists, "two-phase transaction can't join the transaction from the context")
+	}
+	gid, err := c.newGid()
+	if err != nil {
+		return err
+	}
+
+	branches := make([]*branch, 0, len(c.participants))
+	defer func() {
+		if err != nil {
+			c.abort(context.WithoutCancel(ctx), gid, branches)
+		}
+	}()
+
+	scope := Scope{contexts: make(map[string]context.Context, len(c.participants))}
+	for _, participant := range c.participants {
+		tx, err := participant.DB.BeginTx(ctx, pgx.TxOptions{
+			IsoLevel:       pgx.TxIsoLevel(opts.IsoLevel),
+			AccessMode:     pgx.TxAccessMode(opts.AccessMode),
+			DeferrableMode: pgx.TxDeferrableMode(opts.DeferrableMode),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "can't begin transaction on %s", participant.Name)
+		}
+		branches = append(branches, &branch{participant: participant, tx: tx})
+		scope.contexts[participant.Name] = pg_api.MakeContextTx(ctx, tx)
+		if err = pg_api.ApplyLocalOptions(scope.contexts[participant.Name], opts); err != nil {
+			return errors.Wrapf(err, "can't apply options on %s", participant.Name)
+		}
+	}
+
+	if err = runFlow(scope, fn); err != nil {
+		return errors.Wrap(err, "failed executing code inside two-phase transaction")
+	}
+
+	for _, b := range branches {
+		if _, err = b.tx.Exec(ctx, "PREPARE TRANSACTION "+quote(branchGid(gid, b.participant))); err != nil {
+			return errors.Wrapf(err, "can't prepare transaction on %s", b.participant.Name)
+		}
+		b.prepared = true
+		// the session is out of the transaction now, this only hands the connection back to the pool
+		_ = b.tx.Commit(ctx)
+	}
+
+	if _, err = c.log().ExecContext(ctx, pg_api.Query{Name: "twophase.Decide",
+		QueryRaw: "INSERT INTO twophase_decisions (gid) VALUES ($1)"}, gid); err != nil {
+		return errors.Wrap(err, "can't record commit decision")
+	}
+
+	// from here on the transaction is committed, failures are left to Recover
+	commitCtx := context.WithoutCancel(ctx)
+	var failed []string
+	for _, b := range branches {
+		if _, errCommit := b.participant.DB.ExecContext(commitCtx, pg_api.Query{Name: "twophase.Commit",
+			QueryRaw: "COMMIT PREPARED " + quote(branchGid(gid, b.participant))}); errCommit != nil {
+			logger.Logger().Error("commit prepared failed", slog.String("gid", gid),
+				slog.String("participant", b.participant.Name), slog.Any("err", errCommit))
+			failed = append(failed, b.participant.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Wrapf(ErrInDoubt, "transaction %s not committed on %s", gid, strings.Join(failed, ", "))
+	}
+	c.forget(commitCtx, gid)
+	return nil
+}
+
+func runFlow(scope Scope, fn func(scope Scope) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = transaction.NewPanicError(r)
+		}
+	}()
+	return fn(scope)
+}
+
+// abort rolls back the open and the prepared branches, whatever it can't is left to Recover
+func (c *Coordinator) abort(ctx context.Context, gid string, branches []*branch) {
+	for _, b := range branches {
+		var err error
+		if b.prepared {
+			_, err = b.participant.DB.ExecContext(ctx, pg_api.Query{Name: "twophase.Rollback",
+				QueryRaw: "ROLLBACK PREPARED " + quote(branchGid(gid, b.participant))})
+		} else {
+			err = b.tx.Rollback(ctx)
+		}
+		if err != nil {
+			logger.Logger().Error("two-phase rollback failed", slog.String("gid", gid),
+				slog.String("participant", b.participant.Name), slog.Any("err", err))
+		}
+	}
+}
+
+func (c *Coordinator) forget(ctx context.Context, gid string) {
+	if _, err := c.log().ExecContext(ctx, pg_api.Query{Name: "twophase.Forget",
+		QueryRaw: "DELETE FROM twophase_decisions WHERE gid = $1"}, gid); err != nil {
+		logger.Logger().Warn("can't delete commit decision", slog.String("gid", gid), slog.Any("err", err))
+	}
+}
+
+// Recover resolves prepared transactions of this coordinator older than olderThan, left behind by a crash:
+// the ones with a commit decision are committed, the others rolled back. olderThan has to exceed
+// the time Run needs between PREPARE and the decision, so running transactions aren't touched.
+func (c *Coordinator) Recover(ctx context.Context, olderThan time.Duration) error {
+	for _, participant := range c.participants {
+		preparedIds, err := c.orphans(ctx, participant, olderThan)
+		if err != nil {
+			return err
+		}
+		for _, preparedId := range preparedIds {
+			gid, _ := c.decisionGid(preparedId, participant)
+			var committed bool
+			err = c.log().QueryRowContext(ctx, pg_api.Query{Name: "twophase.Decision",
+				QueryRaw: "SELECT EXISTS (SELECT 1 FROM twophase_decisions WHERE gid = $1)"}, gid).Scan(&committed)
+			if err != nil {
+				return errors.Wrap(err, "can't read commit decision")
+			}
+			statement := "ROLLBACK PREPARED "
+			if committed {
+				statement = "COMMIT PREPARED "
+			}
+			if _, err = participant.DB.ExecContext(ctx, pg_api.Query{Name: "twophase.Recover",
+				QueryRaw: statement + quote(preparedId)}); err != nil {
+				return errors.Wrapf(err, "can't resolve %s on %s", preparedId, participant.Name)
+			}
+			logger.Logger().Info("resolved prepared transaction", slog.String("gid", preparedId),
+				slog.String("participant", participant.Name), slog.Bool("committed", committed))
+		}
+	}
+
+	// decisions are needed only while some participant still has the transaction prepared
+	pending := map[string]bool{}
+	for _, participant := range c.participants {
+		preparedIds, err := c.orphans(ctx, participant, 0)
+		if err != nil {
+			return err
+		}
+		for _, preparedId := range preparedIds {
+			gid, _ := c.decisionGid(preparedId, participant)
+			pending[gid] = true
+		}
+	}
+	rows, err := c.log().QueryContext(ctx, pg_api.Query{Name: "twophase.Decisions",
+		QueryRaw: "SELECT gid FROM twophase_decisions WHERE starts_with(gid, $1) AND decided_at < now() - make_interval(secs => $2)"},
+		c.prefix+"_", olderThan.Seconds())
+	if err != nil {
+		return err
+	}
+	decided, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	for _, gid := range decided {
+		if !pending[gid] {
+			c.forget(ctx, gid)
+		}
+	}
+	return nil
+}
+
+// orphans lists the prepared branches of participant, participants sharing a database see each other's
+func (c *Coordinator) orphans(ctx context.Context, participant Participant, olderThan time.Duration) ([]string, error) {
+	rows, err := participant.DB.QueryContext(ctx, pg_api.Query{Name: "twophase.Orphans",
+		QueryRaw: `SELECT gid FROM pg_prepared_xacts
+                   WHERE starts_with(gid, $1) AND database = current_database() AND prepared < now() - make_interval(secs => $2)`},
+		c.prefix+"_", olderThan.Seconds())
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't list prepared transactions on %s", participant.Name)
+	}
+	gids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	branches := gids[:0]
+	for _, gid := range gids {
+		if _, ok := c.decisionGid(gid, participant); ok {
+			branches = append(branches, gid)
+		}
+	}
+	return branches, nil
+}
+
+// branchGid is the id participant prepares its part under, prepared transaction ids are unique
+// per server and participants may be databases of one server
+func branchGid(gid string, participant Participant) string {
+	return gid + "_" + participant.Name
+}
+
+// decisionGid maps a branch id of participant back to the gid of its decision, ok is false for other ids
+func (c *Coordinator) decisionGid(branch string, participant Participant) (string, bool) {
+	rest, ok := strings.CutPrefix(branch, c.prefix+"_")
+	if !ok {
+		return "", false
+	}
+	// the rest is <nanos>_<random>_<participant name>
+	parts := strings.SplitN(rest, "_", 3)
+	if len(parts) != 3 || parts[2] != participant.Name {
+		return "", false
+	}
+	return c.prefix + "_" + parts[0] + "_" + parts[1], true
+}
+
+func (c *Coordinator) newGid() (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s_%d_%s", c.prefix, time.Now().UnixNano(), hex.EncodeToString(random)), nil
+}
+
+func quote(literal string) string {
+	return "'" + strings.ReplaceAll(literal, "'", "''") + "'"
+}
@@ -0,0 +1,66 @@
+package pg
+
+import (
+	"context"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+)
+
+// Projection reads a subset of the repository columns into a DTO instead of the full entity
+type Projection[T any, D any] struct {
+	repo      Repository[T]
+	columns   []string
+	converter func(row pgx.Row) *D
+}
+
+// Project creates a projection of repo, converter scans exactly the given columns in the same order
+func Project[T any, D any](repo Repository[T], columns []string, converter func(row pgx.Row) *D) Projection[T, D] {
+	return Projection[T, D]{repo: repo, columns: columns, converter: converter}
+}
+
+func (p Projection[T, D]) GetAll(ctx context.Context) []D {
+	return p.GetBy(ctx, nil)
+}
+
+func (p Projection[T, D]) GetBy(ctx context.Context, where sq.Sqlizer) []D {
+	selectBuilder := p.repo.selectExpr(p.columns...)
+	if where != nil {
+		selectBuilder = selectBuilder.Where(where)
+	}
+	rows := p.repo.DB.QueryContextSelect(ctx, selectBuilder, nil)
+	defer rows.Close()
+
+	var dtos []D
+	for rows.Next() {
+		if dto := p.converter(rows); dto != nil {
+			dtos = append(dtos, *dto)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		panic(err)
+	}
+	return dtos
+}
+
+// Pluck returns the values of a single column, for example the ids of matching rows
+func Pluck[T any, V any](ctx context.Context, repo Repository[T], column string, where sq.Sqlizer) []V {
+	selectBuilder := repo.selectExpr(column)
+	if where != nil {
+		selectBuilder = selectBuilder.Where(where)
+	}
+	rows := repo.DB.QueryContextSelect(ctx, selectBuilder, nil)
+	defer rows.Close()
+
+	var values []V
+	for rows.Next() {
+		var value V
+		if err := rows.Scan(&value); err != nil {
+			panic(err)
+		}
+		values = append(values, value)
+	}
+	if err := rows.Err(); err != nil {
+		panic(err)
+	}
+	return values
+}
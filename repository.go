@@ -5,6 +5,8 @@ import (
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jackc/pgx/v5"
 	"github.com/lann/builder"
+	"github.com/pkg/errors"
+	"strings"
 )
 
 const (
@@ -34,22 +36,28 @@ type Repository[T any] struct {
 	DeleteBuilder sq.DeleteBuilder
 	UpsertBuilder sq.InsertBuilder
 	ExtraBuilders []builder.Builder
-	Converter     func(row pgx.Row) any // type is any to allow generalization
-	Relations     []Relation[any]       // the relation type is any because it really any entity
-	AddRelated    func(*T, any)
-	AddRelation   func(Relation[any])
+	// UpdatableColumns are the only keys accepted by Update and UpdateCollection, InsertBuilder columns when empty.
+	// Without either no key is accepted.
+	UpdatableColumns []string
+	Converter        func(row pgx.Row) any // type is any to allow generalization
+	Relations        []Relation[any]       // the relation type is any because it really any entity
+	AddRelated       func(*T, any)
+	AddRelation      func(Relation[any])
+	// Events receives the domain events of entities saved with CreateEntity, UpdateEntity and DeleteEntity
+	Events *EventBus
 }
 
 func WrapRepository[R any](repo Repository[R]) Repository[any] {
 	return Repository[any]{
-		anchor:        repo.anchor,
-		DB:            repo.DB,
-		InsertBuilder: repo.InsertBuilder,
-		SelectBuilder: repo.SelectBuilder,
-		UpdateBuilder: repo.UpdateBuilder,
-		DeleteBuilder: repo.DeleteBuilder,
-		UpsertBuilder: repo.UpsertBuilder,
-		ExtraBuilders: repo.ExtraBuilders,
+		anchor:           repo.anchor,
+		DB:               repo.DB,
+		InsertBuilder:    repo.InsertBuilder,
+		SelectBuilder:    repo.SelectBuilder,
+		UpdateBuilder:    repo.UpdateBuilder,
+		DeleteBuilder:    repo.DeleteBuilder,
+		UpsertBuilder:    repo.UpsertBuilder,
+		ExtraBuilders:    repo.ExtraBuilders,
+		UpdatableColumns: repo.UpdatableColumns,
 		Converter: func(row pgx.Row) any {
 			return repo.Converter(row) // Уже возвращает any, можно передавать напрямую
 		},
@@ -61,6 +69,7 @@ func WrapRepository[R any](repo Repository[R]) Repository[any] {
 			}
 		},
 		AddRelation: repo.AddRelation, // Можно передать напрямую, так как уже `Relation[any]`
+		Events:      repo.Events,
 	}
 }
 
@@ -123,6 +132,34 @@ func NewRepository[T any](
 	}
 }
 
+// table is the FROM clause of SelectBuilder
+func (repo Repository[T]) table() string {
+	from, ok := builder.Get(repo.SelectBuilder, "From")
+	if !ok || from == nil {
+		panic(errors.New("repository SelectBuilder has no FROM clause"))
+	}
+	table, _, err := from.(sq.Sqlizer).ToSql()
+	if err != nil {
+		panic(err)
+	}
+	return strings.TrimSpace(table)
+}
+
+// columns are the SelectBuilder columns in the order Converter scans them
+func (repo Repository[T]) columns() []string {
+	parts, _ := builder.Get(repo.SelectBuilder, "Columns")
+	sqlizers, _ := parts.([]sq.Sqlizer)
+	columns := make([]string, 0, len(sqlizers))
+	for _, part := range sqlizers {
+		column, _, err := part.ToSql()
+		if err != nil {
+			panic(err)
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
 func (repo *Repository[T]) loadRelations(ctx context.Context, parentEntities []*T) {
 	if len(repo.Relations) == 0 {
 		return
@@ -246,7 +283,16 @@ func (repo Repository[T]) GetByBuilder(ctx context.Context, selectBuilder sq.Sel
 	return objs
 }
 
-func (repo Repository[T]) GetBy(ctx context.Context, where sq.Sqlizer) []T {
+// GetBy returns entities matching where. With locks the rows are locked until the end of the transaction
+// from TxKey, it panics with ErrNoTransaction outside of one and with *LockNotAvailableError on NoWait conflicts.
+func (repo Repository[T]) GetBy(ctx context.Context, where sq.Sqlizer, locks ...LockOption) []T {
+	if len(locks) > 0 {
+		objs, err := repo.getLocked(ctx, repo.SelectBuilder.Where(where), locks)
+		if err != nil {
+			panic(err)
+		}
+		return objs
+	}
 	return repo.GetByBuilder(ctx, repo.SelectBuilder.Where(where))
 
 }
@@ -259,16 +305,22 @@ func update(ctx context.Context, api DbApi, updateBuilder sq.UpdateBuilder, fiel
 }
 
 func (repo Repository[T]) Delete(ctx context.Context, id int64) int64 {
-	repoBuilder := repo.DeleteBuilder.Where(sq.Eq{idColumn: id})
+	repoBuilder := repo.deleteBuilder().Where(sq.Eq{idColumn: id})
 	return repo.DB.ExecDelete(ctx, repoBuilder)
 }
 
 func (repo Repository[T]) Update(ctx context.Context, fields map[string]interface{}, id int64) int64 {
+	if err := repo.checkUpdatable(fields); err != nil {
+		panic(err)
+	}
 	repoBuilder := repo.UpdateBuilder.Where(sq.Eq{idColumn: id})
 	return update(ctx, repo.DB, repoBuilder, fields)
 }
 
 func (repo Repository[T]) UpdateCollection(ctx context.Context, fields map[string]interface{}, where sq.Sqlizer) int64 {
+	if err := repo.checkUpdatable(fields); err != nil {
+		panic(err)
+	}
 	repoBuilder := repo.UpdateBuilder.Where(where)
 	return update(ctx, repo.DB, repoBuilder, fields)
 }
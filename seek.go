@@ -0,0 +1,283 @@
+package pg
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lann/builder"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+const DefaultSeekLimit uint64 = 100
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrUnknownSortColumn is returned for a sort key which is not a column selected by the repository
+var ErrUnknownSortColumn = errors.New("unknown sort column")
+
+// SortKey is one column of a keyset ordering
+type SortKey struct {
+	Column string
+	Desc   bool
+}
+
+// SeekRequest describes one page of keyset pagination.
+// After and Before are cursors taken from a previous SeekPage, at most one of them may be set.
+// OrderBy must be unique for the table and its columns NOT NULL, the usual way is to finish it with the primary key.
+// When OrderBy is empty the page is ordered by id ascending.
+type SeekRequest struct {
+	After   string
+	Before  string
+	Limit   uint64
+	OrderBy []SortKey
+}
+
+type SeekPage[T any] struct {
+	Items []T
+	Next  string // empty when there is no next page
+	Prev  string // empty when there is no previous page
+}
+
+// Seekable is implemented by entities paged with Seek by columns other than id.
+// SeekValues returns the entity values of the given sort columns in the same order.
+type Seekable interface {
+	SeekValues(columns []string) []any
+}
+
+// Seek returns one page of entities matching where, using row value comparisons on the sort keys
+// instead of OFFSET, so every page costs the same on big tables.
+func (repo Repository[T]) Seek(ctx context.Context, where sq.Sqlizer, req SeekRequest) (SeekPage[T], error) {
+	var page SeekPage[T]
+	if req.After != "" && req.Before != "" {
+		return page, errors.New("seek: After and Before are mutually exclusive")
+	}
+	orderBy := req.OrderBy
+	if len(orderBy) == 0 {
+		orderBy = []SortKey{{Column: idColumn}}
+	}
+	// sort columns end up in the SQL text, so only the selected ones are accepted
+	columns := repo.columns()
+	for _, key := range orderBy {
+		if key.Column != idColumn && !containsColumn(columns, key.Column) {
+			return page, errors.Wrapf(ErrUnknownSortColumn, "seek: %q", key.Column)
+		}
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = DefaultSeekLimit
+	}
+
+	backward := req.Before != ""
+	selectBuilder := builder.Delete(repo.SelectBuilder, "OrderByParts").(sq.SelectBuilder)
+	if where != nil {
+		selectBuilder = selectBuilder.Where(where)
+	}
+	cursor := req.After
+	if backward {
+		cursor = req.Before
+	}
+	if cursor != "" {
+		values, err := decodeCursor(cursor, len(orderBy))
+		if err != nil {
+			return page, err
+		}
+		selectBuilder = selectBuilder.Where(seekCondition(orderBy, values, backward))
+	}
+	selectBuilder = selectBuilder.OrderBy(seekOrder(orderBy, backward)...).Limit(limit + 1)
+
+	rows := repo.DB.QueryContextSelect(ctx, selectBuilder, nil)
+	items := repo.convertToObjects(rows)
+	hasMore := uint64(len(items)) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	items = repo.loadRelationsForCollection(ctx, items)
+	page.Items = items
+	if len(items) == 0 {
+		return page, nil
+	}
+
+	// a backward page always has the rows after it, a forward one has rows before it once a cursor was used
+	first, last := items[0], items[len(items)-1]
+	var err error
+	if (backward && hasMore) || (!backward && cursor != "") {
+		if page.Prev, err = seekCursor(first, orderBy); err != nil {
+			return page, err
+		}
+	}
+	if (!backward && hasMore) || backward {
+		if page.Next, err = seekCursor(last, orderBy); err != nil {
+			return page, err
+		}
+	}
+	return page, nil
+}
+
+func seekOrder(orderBy []SortKey, backward bool) []string {
+	order := make([]string, len(orderBy))
+	for i, key := range orderBy {
+		desc := key.Desc != backward
+		if desc {
+			order[i] = key.Column + " DESC"
+		} else {
+			order[i] = key.Column + " ASC"
+		}
+	}
+	return order
+}
+
+// seekCondition builds the predicate selecting rows placed after (or before, when backward) the cursor values.
+// A single row value comparison is used when all keys share a direction since PostgreSQL can serve it from
+// a composite index, mixed directions fall back to the expanded OR form.
+func seekCondition(orderBy []SortKey, values []any, backward bool) sq.Sqlizer {
+	sameDirection := true
+	for _, key := range orderBy[1:] {
+		if key.Desc != orderBy[0].Desc {
+			sameDirection = false
+			break
+		}
+	}
+	if sameDirection {
+		columns := make([]string, len(orderBy))
+		placeholders := make([]string, len(orderBy))
+		for i, key := range orderBy {
+			columns[i] = key.Column
+			placeholders[i] = "?"
+		}
+		return sq.Expr(fmt.Sprintf("(%s) %s (%s)",
+			strings.Join(columns, ", "), seekOperator(orderBy[0].Desc, backward), strings.Join(placeholders, ", ")),
+			values...)
+	}
+
+	or := sq.Or{}
+	for i, key := range orderBy {
+		and := sq.And{}
+		for j := 0; j < i; j++ {
+			and = append(and, sq.Eq{orderBy[j].Column: values[j]})
+		}
+		and = append(and, sq.Expr(key.Column+" "+seekOperator(key.Desc, backward)+" ?", values[i]))
+		or = append(or, and)
+	}
+	return or
+}
+
+func seekOperator(desc bool, backward bool) string {
+	if desc != backward {
+		return "<"
+	}
+	return ">"
+}
+
+func seekCursor[T any](entity T, orderBy []SortKey) (string, error) {
+	columns := make([]string, len(orderBy))
+	for i, key := range orderBy {
+		columns[i] = key.Column
+	}
+	if s, ok := any(entity).(Seekable); ok {
+		return encodeCursor(s.SeekValues(columns))
+	}
+	if s, ok := any(&entity).(Seekable); ok {
+		return encodeCursor(s.SeekValues(columns))
+	}
+	if len(columns) == 1 && columns[0] == idColumn {
+		if ident, ok := any(entity).(Identifiable); ok {
+			return encodeCursor([]any{ident.GetID()})
+		}
+	}
+	return "", errors.Errorf("seek: %T must implement Seekable to be ordered by %v", entity, columns)
+}
+
+// cursorValue keeps the Go type of a sort key value, plain JSON would turn integers into floats
+// and timestamps into strings.
+type cursorValue struct {
+	Type  string          `json:"t"`
+	Value json.RawMessage `json:"v"`
+}
+
+func encodeCursor(values []any) (string, error) {
+	encoded := make([]cursorValue, len(values))
+	for i, value := range values {
+		var typ string
+		switch v := value.(type) {
+		case int:
+			typ, value = "i", int64(v)
+		case int32:
+			typ, value = "i", int64(v)
+		case int64:
+			typ = "i"
+		case float32:
+			typ, value = "f", float64(v)
+		case float64:
+			typ = "f"
+		case string:
+			typ = "s"
+		case bool:
+			typ = "b"
+		case time.Time:
+			typ = "t"
+		default:
+			return "", errors.Errorf("seek: unsupported cursor value type %T", value)
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", errors.Wrap(err, "seek: can't encode cursor")
+		}
+		encoded[i] = cursorValue{Type: typ, Value: raw}
+	}
+	raw, err := json.Marshal(encoded)
+	if err != nil {
+		return "", errors.Wrap(err, "seek: can't encode cursor")
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(cursor string, size int) ([]any, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var encoded []cursorValue
+	if err = json.Unmarshal(raw, &encoded); err != nil || len(encoded) != size {
+		return nil, ErrInvalidCursor
+	}
+	values := make([]any, size)
+	for i, value := range encoded {
+		switch value.Type {
+		case "i":
+			var v int64
+			err = json.Unmarshal(value.Value, &v)
+			values[i] = v
+		case "f":
+			var v float64
+			err = json.Unmarshal(value.Value, &v)
+			values[i] = v
+		case "s":
+			var v string
+			err = json.Unmarshal(value.Value, &v)
+			values[i] = v
+		case "b":
+			var v bool
+			err = json.Unmarshal(value.Value, &v)
+			values[i] = v
+		case "t":
+			var v time.Time
+			err = json.Unmarshal(value.Value, &v)
+			values[i] = v
+		default:
+			return nil, ErrInvalidCursor
+		}
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return values, nil
+}